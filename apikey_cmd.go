@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/usecases"
+)
+
+const apiKeyUsage = `Usage:
+  apikey mint <name> <scope,scope...>   scopes: create-user, issue-token, admin
+  apikey list
+  apikey revoke <id>`
+
+// Manage api keys from the command line. Returns exit code
+func runAPIKeyCommand(conf *AppConfig, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, apiKeyUsage)
+		return 2
+	}
+	store, err := newRecordStore(conf)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	switch {
+	case args[0] == "mint" && len(args) == 3:
+		key, value, err := usecases.MintAPIKey(store, args[1], strings.Split(args[2], ","))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("id: %s\nkey: %s\n", key.ID, value)
+	case args[0] == "list" && len(args) == 1:
+		cursor := ""
+		for {
+			keys, next, err := usecases.ListAPIKeys(store, cursor, 100)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			for _, key := range keys {
+				status := "active"
+				if key.RevokedAt != nil {
+					status = "revoked"
+				}
+				fmt.Printf("%s\t%s\t%s\t%s\tused %d\n", key.ID, key.Name, strings.Join(key.Scopes, ","), status, key.UsageCount)
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+	case args[0] == "revoke" && len(args) == 2:
+		if err := usecases.RevokeAPIKey(store, args[1]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	default:
+		fmt.Fprintln(os.Stderr, apiKeyUsage)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/golang-jwt/jwt"
+)
+
+// ES256K signing method (RFC 8812): ECDSA with secp256k1 and SHA-256.
+// Signature is 64 bytes R || S
+type SigningMethodES256K struct{}
+
+var SigningMethodSecp256k1 = &SigningMethodES256K{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodSecp256k1.Alg(), func() jwt.SigningMethod {
+		return SigningMethodSecp256k1
+	})
+}
+
+func (m *SigningMethodES256K) Alg() string {
+	return "ES256K"
+}
+
+func (m *SigningMethodES256K) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	hash := sha256.Sum256([]byte(signingString))
+	sig, err := crypto.Sign(hash[:], privateKey)
+	if err != nil {
+		return "", err
+	}
+	return jwt.EncodeSegment(sig[:64]), nil
+}
+
+func (m *SigningMethodES256K) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if len(sig) != 64 {
+		return jwt.ErrECDSAVerification
+	}
+	hash := sha256.Sum256([]byte(signingString))
+	if !crypto.VerifySignature(crypto.FromECDSAPub(publicKey), hash[:], sig) {
+		return jwt.ErrECDSAVerification
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Token signing modes
+const (
+	SignWithUserKey    = "user"    // ES256K with the card key
+	SignWithServiceKey = "service" // service keyring published as JWKS
+)
+
+// Signs tokens issued by the service.
+// In the user mode tokens are signed with the card key when it is available,
+// flows without the card key on the server fall back to the service key
+type Issuer struct {
+	Name    string
+	mode    string
+	keyring *Keyring
+}
+
+func NewIssuer(name, mode string, keyring *Keyring) (*Issuer, error) {
+	if mode == "" {
+		mode = SignWithServiceKey
+	}
+	if mode != SignWithUserKey && mode != SignWithServiceKey {
+		return nil, fmt.Errorf("Unknown signing mode %s", mode)
+	}
+	return &Issuer{Name: name, mode: mode, keyring: keyring}, nil
+}
+
+func (i *Issuer) Keyring() *Keyring {
+	return i.keyring
+}
+
+// Sign claims. For ES256K tokens kid header is the card address
+func (i *Issuer) Sign(claims jwt.MapClaims, userKey *ecdsa.PrivateKey) (string, error) {
+	if i.mode == SignWithUserKey && userKey != nil {
+		token := jwt.NewWithClaims(SigningMethodSecp256k1, claims)
+		token.Header["kid"] = claims["sub"]
+		return token.SignedString(userKey)
+	}
+	key := i.keyring.Active()
+	token := jwt.NewWithClaims(key.Method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signingKey())
+}
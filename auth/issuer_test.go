@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/golang-jwt/jwt"
+)
+
+func TestSignWithUserKey(t *testing.T) {
+	keyring, err := NewKeyring("", AlgES256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := NewIssuer("test", SignWithUserKey, keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userKey, _ := crypto.GenerateKey()
+	signed, err := issuer.Sign(jwt.MapClaims{"sub": "0x1"}, userKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+		return &userKey.PublicKey, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Method.Alg() != "ES256K" || token.Header["kid"] != "0x1" {
+		t.Errorf("Bad token header %v", token.Header)
+	}
+}
+
+func TestSignWithServiceKey(t *testing.T) {
+	for _, alg := range []string{AlgES256, AlgEdDSA} {
+		dir := t.TempDir()
+		keyring, err := NewKeyring(dir, alg, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		issuer, err := NewIssuer("test", SignWithServiceKey, keyring)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signed, err := issuer.Sign(jwt.MapClaims{"sub": "0x1"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := keyring.Rotate(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+			key, ok := keyring.Get(token.Header["kid"].(string))
+			if !ok {
+				return nil, errors.New("unknown key")
+			}
+			return key.VerificationKey(), nil
+		}); err == nil {
+			t.Errorf("%s: token of the rotated out key should not verify", alg)
+		}
+
+		// Keys are loaded from the directory
+		reloaded, err := NewKeyring(dir, alg, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reloaded.JWKS().Keys) != 2 || reloaded.Active().ID != keyring.Active().ID {
+			t.Errorf("%s: bad reloaded keys %v", alg, reloaded.JWKS())
+		}
+		signed, err = issuer.Sign(jwt.MapClaims{"sub": "0x1"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+			key, _ := reloaded.Get(token.Header["kid"].(string))
+			return key.VerificationKey(), nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		if token.Method.Alg() != alg {
+			t.Errorf("Bad alg %s", token.Method.Alg())
+		}
+	}
+}
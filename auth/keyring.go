@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Supported service key algorithms
+const (
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Service signing key
+type Key struct {
+	ID        string
+	Alg       string
+	Private   crypto.Signer
+	CreatedAt time.Time
+}
+
+func (k Key) Method() jwt.SigningMethod {
+	if k.Alg == AlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodES256
+}
+
+// Key used by jwt library for signing
+func (k Key) signingKey() interface{} {
+	if k.Alg == AlgEdDSA {
+		return k.Private.(ed25519.PrivateKey)
+	}
+	return k.Private
+}
+
+// Key used by jwt library for verification
+func (k Key) VerificationKey() interface{} {
+	return k.Private.Public()
+}
+
+// JSON Web Key of the public part
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k Key) JWK() JWK {
+	jwk := JWK{Kid: k.ID, Alg: k.Alg, Use: "sig"}
+	switch pub := k.Private.Public().(type) {
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+	}
+	return jwk
+}
+
+// Set of service signing keys.
+// The newest key signs tokens, previous keys stay published for verification until rotated out.
+// Keys are kept as PKCS8 pem files in the directory, empty directory keeps keys in memory only
+type Keyring struct {
+	mu     sync.RWMutex
+	dir    string
+	alg    string
+	retain int
+	keys   []Key
+}
+
+func NewKeyring(dir, alg string, retain int) (*Keyring, error) {
+	if alg == "" {
+		alg = AlgES256
+	}
+	if alg != AlgES256 && alg != AlgEdDSA {
+		return nil, fmt.Errorf("Unsupported key algorithm %s", alg)
+	}
+	if retain < 1 {
+		retain = 1
+	}
+	k := &Keyring{dir: dir, alg: alg, retain: retain}
+	if dir != "" {
+		if err := k.load(); err != nil {
+			return nil, err
+		}
+	}
+	if len(k.keys) == 0 {
+		if err := k.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+func (k *Keyring) load() error {
+	files, err := filepath.Glob(filepath.Join(k.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return fmt.Errorf("Bad pem file %s", file)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		key := Key{ID: strings.TrimSuffix(filepath.Base(file), ".pem"), CreatedAt: info.ModTime()}
+		switch private := parsed.(type) {
+		case ed25519.PrivateKey:
+			key.Alg, key.Private = AlgEdDSA, private
+		case *ecdsa.PrivateKey:
+			key.Alg, key.Private = AlgES256, private
+		default:
+			return fmt.Errorf("Unsupported key type in %s", file)
+		}
+		k.keys = append(k.keys, key)
+	}
+	// Key ids start with the creation time
+	sort.Slice(k.keys, func(i, j int) bool { return k.keys[i].ID > k.keys[j].ID })
+	return nil
+}
+
+// Generate new active key and drop keys over the retain limit
+func (k *Keyring) Rotate() error {
+	var private crypto.Signer
+	var err error
+	if k.alg == AlgEdDSA {
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	} else {
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	now := time.Now()
+	id := fmt.Sprintf("%s-%s", strconv.FormatInt(now.UnixNano(), 36), hex.EncodeToString(suffix))
+	key := Key{ID: id, Alg: k.alg, Private: private, CreatedAt: now}
+	if k.dir != "" {
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		if err != nil {
+			return err
+		}
+		data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err := ioutil.WriteFile(filepath.Join(k.dir, key.ID+".pem"), data, 0600); err != nil {
+			return err
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = append([]Key{key}, k.keys...)
+	for len(k.keys) > k.retain {
+		old := k.keys[len(k.keys)-1]
+		k.keys = k.keys[:len(k.keys)-1]
+		if k.dir != "" {
+			os.Remove(filepath.Join(k.dir, old.ID+".pem"))
+		}
+	}
+	return nil
+}
+
+// Rotate keys every period until done channel is closed
+func (k *Keyring) AutoRotate(period time.Duration, done <-chan struct{}, onError func(error)) {
+	if period <= 0 {
+		return
+	}
+	ticker := time.NewTicker(period)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := k.Rotate(); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+func (k *Keyring) Active() Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys[0]
+}
+
+func (k *Keyring) Get(id string) (Key, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.ID == id {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+func (k *Keyring) JWKS() JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	jwks := JWKS{Keys: make([]JWK, 0, len(k.keys))}
+	for _, key := range k.keys {
+		jwks.Keys = append(jwks.Keys, key.JWK())
+	}
+	return jwks
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type contextKey struct{}
+
+// Gin context key of the verified *Claims
+const ClaimsKey = "auth.claims"
+
+func bearerToken(header string) string {
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// Gin middleware that rejects requests without valid bearer token.
+// It doesn't call c.Next, so it can be called from other middleware before further checks
+func Middleware(v *Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c.GetHeader("Authorization"))
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, map[string]interface{}{"error": "bearer token required"})
+			return
+		}
+		claims, err := v.Verify(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		c.Set(ClaimsKey, claims)
+	}
+}
+
+// Verified claims set by Middleware
+func GetClaims(c *gin.Context) (*Claims, bool) {
+	v, ok := c.Get(ClaimsKey)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := v.(*Claims)
+	return claims, ok
+}
+
+// User data from the "dat" claim set by Middleware
+func UserData(c *gin.Context) map[string]interface{} {
+	if claims, ok := GetClaims(c); ok {
+		return claims.Data
+	}
+	return nil
+}
+
+// net/http middleware for services that don't use gin
+func HTTPMiddleware(v *Verifier, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := v.Verify(bearerToken(r.Header.Get("Authorization")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, claims)))
+	})
+}
+
+// Verified claims set by HTTPMiddleware
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok
+}
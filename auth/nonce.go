@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrTooManyNonces = errors.New("too many outstanding nonces")
+
+type nonce struct {
+	address   string
+	expiresAt time.Time
+}
+
+// Concurrency safe store of one-time login nonces, at most max nonces are outstanding
+type NonceStore struct {
+	ttl    time.Duration
+	max    int
+	mu     sync.Mutex
+	nonces map[string]nonce
+	queue  []string // nonces in issue order, all have the same ttl so they expire in this order
+}
+
+func NewNonceStore(ttl time.Duration, max int) *NonceStore {
+	return &NonceStore{
+		ttl:    ttl,
+		max:    max,
+		nonces: make(map[string]nonce),
+	}
+}
+
+// Issue new nonce for the address, ErrTooManyNonces while max nonces are outstanding
+func (s *NonceStore) Issue(address string) (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	value := hex.EncodeToString(raw)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.expire(now)
+	if len(s.nonces) >= s.max {
+		return "", ErrTooManyNonces
+	}
+	s.nonces[value] = nonce{address: strings.ToLower(address), expiresAt: now.Add(s.ttl)}
+	s.queue = append(s.queue, value)
+	return value, nil
+}
+
+// Remove expired nonces from the head of the queue, consumed nonces are dropped from the queue on the way
+func (s *NonceStore) expire(now time.Time) {
+	i := 0
+	for ; i < len(s.queue); i++ {
+		n, ok := s.nonces[s.queue[i]]
+		if ok && now.Before(n.expiresAt) {
+			break
+		}
+		delete(s.nonces, s.queue[i])
+	}
+	s.queue = s.queue[i:]
+}
+
+// Remove the nonce and report if it was issued for the address and not expired
+func (s *NonceStore) Consume(value, address string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.nonces[value]
+	if !ok {
+		return false
+	}
+	delete(s.nonces, value)
+	return n.address == strings.ToLower(address) && time.Now().Before(n.expiresAt)
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNonceStore(t *testing.T) {
+	nonces := NewNonceStore(50*time.Millisecond, 2)
+	first, err := nonces.Issue("0xABC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nonces.Issue("0xabc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nonces.Issue("0xabc"); !errors.Is(err, ErrTooManyNonces) {
+		t.Fatalf("Expected ErrTooManyNonces, got %v", err)
+	}
+
+	// Consumed nonce frees its place and can't be used again
+	if !nonces.Consume(first, "0xabc") || nonces.Consume(first, "0xabc") {
+		t.Fatal("Nonce is not consumed once")
+	}
+	third, err := nonces.Issue("0xabc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Expired nonces are removed on the next issue
+	time.Sleep(60 * time.Millisecond)
+	if _, err := nonces.Issue("0xabc"); err != nil {
+		t.Fatal(err)
+	}
+	if len(nonces.nonces) != 1 || len(nonces.queue) != 1 {
+		t.Fatalf("Expected one outstanding nonce, got %d in queue of %d", len(nonces.nonces), len(nonces.queue))
+	}
+	if nonces.Consume(third, "0xabc") {
+		t.Fatal("Expired nonce is consumed")
+	}
+}
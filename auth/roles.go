@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Known user roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+func IsKnownRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
+}
+
+func (c *Claims) HasRole(roles ...string) bool {
+	for _, have := range c.Roles {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Current roles of the token subject
+type RoleSource func(subject string) ([]string, error)
+
+// Gin middleware that allows requests with any of the roles.
+// Roles are loaded from the source rather than taken from the token claim.
+// Must be used after Middleware
+func RequireRoles(source RoleSource, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := GetClaims(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, map[string]interface{}{"error": "bearer token required"})
+			return
+		}
+		current, err := source(claims.Subject)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		claims.Roles = current
+		if !claims.HasRole(roles...) {
+			c.AbortWithStatusJSON(http.StatusForbidden, map[string]interface{}{"error": "forbidden"})
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const siwePreamble = " wants you to sign in with your Ethereum account:"
+
+var (
+	ErrBadSIWEMessage   = errors.New("bad siwe message")
+	ErrBadSIWESignature = errors.New("bad siwe signature")
+	ErrBadSignature     = errors.New("bad signature")
+)
+
+// EIP-4361 Sign-In with Ethereum message
+type SIWEMessage struct {
+	Domain         string
+	Address        common.Address
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        int64
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime *time.Time
+	NotBefore      *time.Time
+	RequestID      string
+	Resources      []string
+}
+
+func ParseSIWEMessage(message string) (msg SIWEMessage, err error) {
+	lines := strings.Split(message, "\n")
+	if len(lines) < 3 || !strings.HasSuffix(lines[0], siwePreamble) {
+		return msg, ErrBadSIWEMessage
+	}
+	msg.Domain = strings.TrimSuffix(lines[0], siwePreamble)
+	if !common.IsHexAddress(lines[1]) {
+		return msg, fmt.Errorf("%w: bad address", ErrBadSIWEMessage)
+	}
+	msg.Address = common.HexToAddress(lines[1])
+
+	// Blank line, optional statement line and blank line
+	i := 2
+	if lines[i] != "" {
+		return msg, ErrBadSIWEMessage
+	}
+	i++
+	if i < len(lines) && lines[i] != "" {
+		msg.Statement = lines[i]
+		i++
+	}
+	if i >= len(lines) || lines[i] != "" {
+		return msg, ErrBadSIWEMessage
+	}
+	i++
+
+	var issuedAt string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if line == "Resources:" {
+			for _, res := range lines[i+1:] {
+				if !strings.HasPrefix(res, "- ") {
+					return msg, fmt.Errorf("%w: bad resource", ErrBadSIWEMessage)
+				}
+				msg.Resources = append(msg.Resources, strings.TrimPrefix(res, "- "))
+			}
+			break
+		}
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return msg, fmt.Errorf("%w: bad line %q", ErrBadSIWEMessage, line)
+		}
+		switch key {
+		case "URI":
+			msg.URI = value
+		case "Version":
+			msg.Version = value
+		case "Chain ID":
+			if msg.ChainID, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return msg, fmt.Errorf("%w: bad chain id", ErrBadSIWEMessage)
+			}
+		case "Nonce":
+			msg.Nonce = value
+		case "Issued At":
+			issuedAt = value
+		case "Expiration Time":
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return msg, fmt.Errorf("%w: bad expiration time", ErrBadSIWEMessage)
+			}
+			msg.ExpirationTime = &t
+		case "Not Before":
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return msg, fmt.Errorf("%w: bad not before", ErrBadSIWEMessage)
+			}
+			msg.NotBefore = &t
+		case "Request ID":
+			msg.RequestID = value
+		default:
+			return msg, fmt.Errorf("%w: unknown field %q", ErrBadSIWEMessage, key)
+		}
+	}
+	if msg.URI == "" || msg.Version != "1" || msg.Nonce == "" || issuedAt == "" {
+		return msg, fmt.Errorf("%w: missing required field", ErrBadSIWEMessage)
+	}
+	if msg.IssuedAt, err = time.Parse(time.RFC3339, issuedAt); err != nil {
+		return msg, fmt.Errorf("%w: bad issued at", ErrBadSIWEMessage)
+	}
+	return msg, nil
+}
+
+// Check message validity time
+func (m SIWEMessage) Valid(now time.Time) error {
+	if m.ExpirationTime != nil && now.After(*m.ExpirationTime) {
+		return fmt.Errorf("%w: message expired", ErrBadSIWEMessage)
+	}
+	if m.NotBefore != nil && now.Before(*m.NotBefore) {
+		return fmt.Errorf("%w: message not valid yet", ErrBadSIWEMessage)
+	}
+	return nil
+}
+
+// Check EIP-191 personal signature of the message by the message address
+func VerifySIWESignature(message string, msg SIWEMessage, signature string) error {
+	signer, err := RecoverPersonalSigner(message, signature)
+	if err != nil || signer != msg.Address {
+		return ErrBadSIWESignature
+	}
+	return nil
+}
+
+// Recover address of EIP-191 personal signature
+func RecoverPersonalSigner(message, signature string) (common.Address, error) {
+	sig, err := hexutil.Decode(signature)
+	if err != nil || len(sig) != 65 {
+		return common.Address{}, ErrBadSignature
+	}
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash([]byte(message)), sig)
+	if err != nil {
+		return common.Address{}, ErrBadSignature
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
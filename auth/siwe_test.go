@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestSIWE(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	nonces := NewNonceStore(time.Minute, 100)
+	nonce, err := nonces.Issue(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := fmt.Sprintf(`promisecards.eth wants you to sign in with your Ethereum account:
+%s
+
+Sign in to Promise Cards
+
+URI: https://promisecards.eth/login
+Version: 1
+Chain ID: 5
+Nonce: %s
+Issued At: %s
+Expiration Time: %s`, address, nonce, time.Now().UTC().Format(time.RFC3339), time.Now().Add(time.Minute).UTC().Format(time.RFC3339))
+	msg, err := ParseSIWEMessage(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Domain != "promisecards.eth" || msg.Statement != "Sign in to Promise Cards" || msg.ChainID != 5 || msg.Nonce != nonce {
+		t.Fatalf("Unexpected message %+v", msg)
+	}
+	if err := msg.Valid(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := msg.Valid(time.Now().Add(time.Hour)); !errors.Is(err, ErrBadSIWEMessage) {
+		t.Fatalf("Expected expired message, got %v", err)
+	}
+
+	sig, err := crypto.Sign(accounts.TextHash([]byte(message)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+	if err := VerifySIWESignature(message, msg, hexutil.Encode(sig)); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := crypto.GenerateKey()
+	sig, _ = crypto.Sign(accounts.TextHash([]byte(message)), other)
+	if err := VerifySIWESignature(message, msg, hexutil.Encode(sig)); !errors.Is(err, ErrBadSIWESignature) {
+		t.Fatalf("Expected ErrBadSIWESignature, got %v", err)
+	}
+
+	if !nonces.Consume(nonce, address) {
+		t.Fatal("Expected valid nonce")
+	}
+	if nonces.Consume(nonce, address) {
+		t.Fatal("Nonce must be consumed once")
+	}
+}
+
+func TestSIWEWithoutStatement(t *testing.T) {
+	address := "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	msg, err := ParseSIWEMessage("promisecards.eth wants you to sign in with your Ethereum account:\n" + address + `
+
+
+URI: https://promisecards.eth/login
+Version: 1
+Chain ID: 1
+Nonce: 32891756
+Issued At: 2023-05-01T10:00:00Z`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Statement != "" || msg.URI != "https://promisecards.eth/login" || msg.Address.Hex() != address {
+		t.Fatalf("Unexpected message %+v", msg)
+	}
+
+	// Statement must be followed by the blank line
+	_, err = ParseSIWEMessage("promisecards.eth wants you to sign in with your Ethereum account:\n" + address + `
+
+Sign in to Promise Cards
+URI: https://promisecards.eth/login
+Version: 1
+Chain ID: 1
+Nonce: 32891756
+Issued At: 2023-05-01T10:00:00Z`)
+	if !errors.Is(err, ErrBadSIWEMessage) {
+		t.Fatalf("Expected ErrBadSIWEMessage, got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/golang-jwt/jwt"
+)
+
+var (
+	ErrUnknownKey   = errors.New("unknown signing key")
+	ErrInvalidAlg   = errors.New("unsupported signing algorithm")
+	ErrBadSubject   = errors.New("token subject doesn't match the signer")
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Values of the token_use claim. Only access tokens are accepted as bearer tokens
+const (
+	TokenUseAccess = "access"
+	TokenUseID     = "id"
+)
+
+// Source of the service verification keys
+type KeySource interface {
+	VerificationKey(kid string) (interface{}, error)
+}
+
+// Verified token claims
+type Claims struct {
+	Subject   string                 `json:"sub"`
+	Issuer    string                 `json:"iss"`
+	ExpiresAt int64                  `json:"exp"`
+	IssuedAt  int64                  `json:"iat"`
+	NotBefore int64                  `json:"nbf"`
+	Data      map[string]interface{} `json:"dat"`
+	Roles     []string               `json:"roles"`
+	Raw       jwt.MapClaims          `json:"-"`
+}
+
+// Verifies access tokens of the promise card service: signature, exp/nbf, issuer, audience and token use.
+// Only tokens signed by the service keys are accepted, ES256K tokens signed with the card key
+// are verified by VerifyCardToken
+type Verifier struct {
+	Issuer   string
+	Audience string
+	Keys     KeySource
+}
+
+// Verifier of the tokens issued to the service itself, the audience is the issuer
+func NewVerifier(issuer string, keys KeySource) *Verifier {
+	return &Verifier{Issuer: issuer, Audience: issuer, Keys: keys}
+}
+
+func (v *Verifier) Verify(tokenString string) (*Claims, error) {
+	mapClaims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, mapClaims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		switch token.Method.Alg() {
+		case AlgES256, AlgEdDSA:
+			return v.Keys.VerificationKey(kid)
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAlg, token.Method.Alg())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !mapClaims.VerifyIssuer(v.Issuer, true) {
+		return nil, fmt.Errorf("%w: bad issuer", ErrInvalidToken)
+	}
+	if use, _ := mapClaims["token_use"].(string); use != TokenUseAccess {
+		return nil, fmt.Errorf("%w: not an access token", ErrInvalidToken)
+	}
+	if !mapClaims.VerifyAudience(v.Audience, true) {
+		return nil, fmt.Errorf("%w: bad audience", ErrInvalidToken)
+	}
+	return newClaims(mapClaims), nil
+}
+
+// Verify ES256K token signed with the card key of the subject address.
+// Anyone holding the card key can sign such a token, so it only proves the key possession
+// and must be exchanged for the service token, its roles and data are not trusted
+func (v *Verifier) VerifyCardToken(tokenString string) (*Claims, error) {
+	mapClaims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, mapClaims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() != SigningMethodSecp256k1.Alg() {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAlg, token.Method.Alg())
+		}
+		return recoverSigner(token.Raw, mapClaims)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !mapClaims.VerifyIssuer(v.Issuer, true) {
+		return nil, fmt.Errorf("%w: bad issuer", ErrInvalidToken)
+	}
+	claims := newClaims(mapClaims)
+	claims.Roles, claims.Data = nil, nil
+	return claims, nil
+}
+
+func newClaims(mapClaims jwt.MapClaims) *Claims {
+	claims := &Claims{Raw: mapClaims}
+	claims.Subject, _ = mapClaims["sub"].(string)
+	claims.Issuer, _ = mapClaims["iss"].(string)
+	claims.ExpiresAt = intClaim(mapClaims["exp"])
+	claims.IssuedAt = intClaim(mapClaims["iat"])
+	claims.NotBefore = intClaim(mapClaims["nbf"])
+	claims.Data, _ = mapClaims["dat"].(map[string]interface{})
+	if roles, ok := mapClaims["roles"].([]interface{}); ok {
+		for _, role := range roles {
+			if s, ok := role.(string); ok {
+				claims.Roles = append(claims.Roles, s)
+			}
+		}
+	}
+	return claims
+}
+
+func intClaim(v interface{}) int64 {
+	if f, ok := v.(float64); ok {
+		return int64(f)
+	}
+	return 0
+}
+
+// Recover ES256K signer key and check it is the subject address
+func recoverSigner(raw string, claims jwt.MapClaims) (interface{}, error) {
+	dot := strings.LastIndex(raw, ".")
+	if dot < 0 {
+		return nil, ErrInvalidToken
+	}
+	sig, err := jwt.DecodeSegment(raw[dot+1:])
+	if err != nil || len(sig) != 64 {
+		return nil, ErrInvalidToken
+	}
+	hash := sha256.Sum256([]byte(raw[:dot]))
+	subject, _ := claims["sub"].(string)
+	for v := byte(0); v < 2; v++ {
+		pub, err := crypto.SigToPub(hash[:], append(sig, v))
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(crypto.PubkeyToAddress(*pub).Hex(), subject) {
+			return pub, nil
+		}
+	}
+	return nil, ErrBadSubject
+}
+
+func (k *Keyring) VerificationKey(kid string) (interface{}, error) {
+	key, ok := k.Get(kid)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key.VerificationKey(), nil
+}
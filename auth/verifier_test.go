@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+func testClaims(subject string, ttl time.Duration) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"sub":       subject,
+		"iss":       "test",
+		"aud":       "test",
+		"exp":       now.Add(ttl).Unix(),
+		"iat":       now.Unix(),
+		"nbf":       now.Unix(),
+		"dat":       map[string]interface{}{"nick": "alice"},
+		"token_use": TokenUseAccess,
+	}
+}
+
+func TestVerifyCardToken(t *testing.T) {
+	keyring, _ := NewKeyring("", AlgES256, 1)
+	issuer, _ := NewIssuer("test", SignWithUserKey, keyring)
+	userKey, _ := crypto.GenerateKey()
+	address := crypto.PubkeyToAddress(userKey.PublicKey).Hex()
+	verifier := NewVerifier("test", keyring)
+
+	cardClaims := testClaims(address, time.Minute)
+	cardClaims["roles"] = []string{RoleAdmin}
+	signed, err := issuer.Sign(cardClaims, userKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(signed); err == nil {
+		t.Error("Token signed with the card key should not verify as service token")
+	}
+	claims, err := verifier.VerifyCardToken(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != address || claims.Roles != nil || claims.Data != nil {
+		t.Errorf("Bad claims %+v", claims)
+	}
+
+	otherKey, _ := crypto.GenerateKey()
+	signed, _ = issuer.Sign(testClaims(address, time.Minute), otherKey)
+	if _, err := verifier.VerifyCardToken(signed); err == nil {
+		t.Error("Token signed by another key should not verify")
+	}
+	signed, _ = issuer.Sign(testClaims(address, -time.Minute), userKey)
+	if _, err := verifier.VerifyCardToken(signed); err == nil {
+		t.Error("Expired token should not verify")
+	}
+	signed, _ = issuer.Sign(testClaims(address, time.Minute), nil)
+	if _, err := verifier.VerifyCardToken(signed); err == nil {
+		t.Error("Service token should not verify as card token")
+	}
+}
+
+func TestVerifyWithJWKS(t *testing.T) {
+	keyring, _ := NewKeyring("", AlgEdDSA, 1)
+	issuer, _ := NewIssuer("test", SignWithServiceKey, keyring)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(keyring.JWKS())
+	}))
+	defer server.Close()
+	verifier := NewVerifier("test", NewJWKSClient(server.URL))
+
+	signed, err := issuer.Sign(testClaims("0x1", time.Minute), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(signed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewVerifier("other", verifier.Keys).Verify(signed); err == nil {
+		t.Error("Token of another issuer should not verify")
+	}
+
+	idClaims := testClaims("0x1", time.Minute)
+	idClaims["aud"] = "client"
+	idClaims["token_use"] = TokenUseID
+	signed, _ = issuer.Sign(idClaims, nil)
+	if _, err := verifier.Verify(signed); err == nil {
+		t.Error("ID token should not verify as access token")
+	}
+	otherAudience := testClaims("0x1", time.Minute)
+	otherAudience["aud"] = "client"
+	signed, _ = issuer.Sign(otherAudience, nil)
+	if _, err := verifier.Verify(signed); err == nil {
+		t.Error("Access token of another audience should not verify")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keyring, _ := NewKeyring("", AlgES256, 1)
+	issuer, _ := NewIssuer("test", SignWithServiceKey, keyring)
+	r := gin.New()
+	r.GET("/me", Middleware(NewVerifier("test", keyring)), func(c *gin.Context) {
+		c.JSON(http.StatusOK, UserData(c))
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/me", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", w.Code)
+	}
+
+	signed, _ := issuer.Sign(testClaims("0x1", time.Minute), nil)
+	req := httptest.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+signed)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != `{"nick":"alice"}` {
+		t.Errorf("Bad response %d %s", w.Code, w.Body.String())
+	}
+}
+
+// Handler after the middleware runs only when the checks called in one middleware pass
+func TestMiddlewareChecksInOneHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keyring, _ := NewKeyring("", AlgES256, 1)
+	issuer, _ := NewIssuer("test", SignWithServiceKey, keyring)
+	bearer := Middleware(NewVerifier("test", keyring))
+	role := RequireRoles(func(string) ([]string, error) { return []string{RoleUser}, nil }, RoleAdmin)
+	reached := false
+	r := gin.New()
+	r.GET("/admin", func(c *gin.Context) {
+		bearer(c)
+		if !c.IsAborted() {
+			role(c)
+		}
+	}, func(c *gin.Context) {
+		reached = true
+	})
+
+	signed, _ := issuer.Sign(testClaims("0x1", time.Minute), nil)
+	req := httptest.NewRequest("GET", "/admin", nil)
+	req.Header.Set("Authorization", "Bearer "+signed)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden || reached {
+		t.Errorf("Expected 403 before the handler, got %d, handler reached %v", w.Code, reached)
+	}
+}
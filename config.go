@@ -26,6 +26,50 @@ type AppConfig struct {
 	EnsMainDomain      string `env:"ENS_MAIN_DOMAIN"`
 	EnsResolverAddress string `env:"ENS_RESOLWER_ADDRESS"`
 	PinataKey          string `env:"PINATA_KEY"`
+	// ENS writes
+	ENSConfirmations  string `env:"ENS_CONFIRMATIONS"`   // blocks to wait including the tx block, 1 if empty
+	ENSConfirmTimeout string `env:"ENS_CONFIRM_TIMEOUT"` // 5m if empty
+	ENSResubmitAfter  string `env:"ENS_RESUBMIT_AFTER"`  // replace pending tx by fee after, 1m if empty
+	ENSReverseRecords string `env:"ENS_REVERSE_RECORDS"` // "true" sets reverse records of new card addresses, the root owner must be a reverse registrar controller
+	ENSKeepCustody    string `env:"ENS_KEEP_CUSTODY"`    // "true" keeps subdomains with the root owner so PUT /users/:address/records works
+	// ENS fees, caps in gwei per gas, no cap if empty
+	ENSMaxFeeGwei string `env:"ENS_MAX_FEE_GWEI"`
+	ENSMaxTipGwei string `env:"ENS_MAX_TIP_GWEI"`
+	ENSGasMargin  string `env:"ENS_GAS_MARGIN"` // estimated gas multiplier, 1.2 if empty
+	// Timelock network: http (default) or local
+	TimelockNetwork      string `env:"TIMELOCK_NETWORK"`
+	TimelockLocalSeed    string `env:"TIMELOCK_LOCAL_SEED"`    // local network key seed, required by the local network
+	TimelockLocalGenesis string `env:"TIMELOCK_LOCAL_GENESIS"` // unix time, required by the local network
+	TimelockLocalPeriod  string `env:"TIMELOCK_LOCAL_PERIOD"`  // round period, 3s if empty
+	// Token signing
+	JWTIssuer       string `env:"JWT_ISSUER"`        // promisecards if empty, https base url required when OIDC_LOGIN_URL is set
+	JWTSigning      string `env:"JWT_SIGNING"`       // service (default) or user, user tokens are exchanged for service tokens at /token/exchange
+	JWTKeyAlg       string `env:"JWT_KEY_ALG"`       // ES256 (default) or EdDSA
+	JWTKeysDir      string `env:"JWT_KEYS_DIR"`      // service keys directory, in memory keys if empty
+	JWTKeyRotation  string `env:"JWT_KEY_ROTATION"`  // service key rotation period, no rotation if empty
+	AccessTokenTTL  string `env:"ACCESS_TOKEN_TTL"`  // 10m if empty
+	RefreshTokenTTL string `env:"REFRESH_TOKEN_TTL"` // 720h if empty
+	SIWEDomain      string `env:"SIWE_DOMAIN"`       // domain check of sign-in messages is skipped if empty
+	SIWEChainID     string `env:"SIWE_CHAIN_ID"`     // chain ID of sign-in messages, 1 if empty
+	OIDCLoginURL    string `env:"OIDC_LOGIN_URL"`    // promise card app page that completes OpenID Connect authorization requests
+	AdminAddresses  string `env:"ADMIN_ADDRESSES"`   // comma separated addresses granted admin role on start
+	// Storage
+	StorageBackend string `env:"STORAGE_BACKEND"` // polybase (default) or bolt
+	StoragePath    string `env:"STORAGE_PATH"`    // bolt database file
+	// Abuse protection of POST /users, limits are N/unit (s, m, h, d), no limit if empty
+	RateLimitBackend string `env:"RATE_LIMIT_BACKEND"` // memory (default)
+	RateLimitIP      string `env:"RATE_LIMIT_IP"`
+	RateLimitAPIKey  string `env:"RATE_LIMIT_API_KEY"`
+	RateLimitGlobal  string `env:"RATE_LIMIT_GLOBAL"`
+	PoWDifficulty    string `env:"POW_DIFFICULTY"`     // leading zero bits, proof of work is disabled if empty
+	CaptchaVerifyURL string `env:"CAPTCHA_VERIFY_URL"` // siteverify url, captcha is disabled if empty
+	CaptchaSecret    string `env:"CAPTCHA_SECRET"`
+	RateLimitRecords string `env:"RATE_LIMIT_RECORDS"` // per user limit of PUT /users/:address/records, 10/h if empty
+	RateLimitLookups string `env:"RATE_LIMIT_LOOKUPS"` // per ip limit of GET /users/available, 60/m if empty
+	RateLimitNonces  string `env:"RATE_LIMIT_NONCES"`  // per ip limit of GET /auth/nonce, 30/m if empty
+	TrustedProxies   string `env:"TRUSTED_PROXIES"`    // comma separated proxy addresses or CIDRs, client ip is the remote address if empty
+	// API keys of POST /users and POST /token callers, keys are minted with "apikey mint" command
+	APIKeysRequired string `env:"API_KEYS_REQUIRED"` // true if empty, false disables api key check
 }
 
 var conf AppConfig
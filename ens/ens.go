@@ -5,115 +5,471 @@ import (
 	"crypto/ecdsa"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
+	"net"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	ens "github.com/wealdtech/go-ens/v3"
+	"go.uber.org/zap"
 )
 
+var (
+	ErrClosed       = errors.New("ens service closed")
+	ErrNoName       = errors.New("name is not registered")
+	ErrNotCustodian = errors.New("subdomain is owned by the card address")
+)
+
+const (
+	defaultConfirmTimeout = 5 * time.Minute
+	defaultResubmitAfter  = time.Minute
+)
+
+// Chain client of the ENS service, *ethclient.Client dialed with RPCUrl
+type chainClient interface {
+	bind.ContractBackend
+	feeBackend
+	txBackend
+	ChainID(ctx context.Context) (*big.Int, error)
+	Close()
+}
+
+// ENS service settings
+type Config struct {
+	OwnerAddress    string
+	PrivateKey      string
+	MainDomain      string
+	RPCUrl          string
+	ResolverAddress string
+	Confirmations   uint64        // blocks including the tx block, 1 if zero
+	ConfirmTimeout  time.Duration // 5 minutes if zero
+	ResubmitAfter   time.Duration // replace by fee after, 1 minute if zero
+	MaxGasFeeCap    *big.Int      // wei per gas, no limit if nil
+	MaxGasTipCap    *big.Int      // wei per gas, no limit if nil
+	GasMargin       float64       // estimated gas multiplier, 1.2 if zero
+	ReverseRecords  bool          // set reverse record of new card addresses, root owner is a reverse registrar controller
+	KeepCustody     bool          // root owner keeps subdomains to manage their records, cards own them otherwise
+}
+
+// ENS service of the main domain owner.
+// RPC client and contract bindings are created on first use and shared between calls,
+// broken connection is dialed again on the next call
 type ENSAdaptor struct {
 	OwnerAddress    string
 	PrivateKey      string
 	MainDomain      string
 	RPCUrl          string
 	ResolverAddress string
+	Confirmations   uint64
+	ConfirmTimeout  time.Duration
+	ResubmitAfter   time.Duration
+	MaxGasFeeCap    *big.Int
+	MaxGasTipCap    *big.Int
+	GasMargin       float64
+	ReverseRecords  bool
+	KeepCustody     bool
+
+	mu        sync.Mutex
+	closed    bool
+	client    chainClient
+	registry  *ens.Registry
+	resolvers map[string]*ens.Resolver
+}
+
+func NewENSAdaptor(conf Config) *ENSAdaptor {
+	return &ENSAdaptor{
+		OwnerAddress:    conf.OwnerAddress,
+		PrivateKey:      conf.PrivateKey,
+		MainDomain:      conf.MainDomain,
+		RPCUrl:          conf.RPCUrl,
+		ResolverAddress: conf.ResolverAddress,
+		Confirmations:   conf.Confirmations,
+		ConfirmTimeout:  conf.ConfirmTimeout,
+		ResubmitAfter:   conf.ResubmitAfter,
+		MaxGasFeeCap:    conf.MaxGasFeeCap,
+		MaxGasTipCap:    conf.MaxGasTipCap,
+		GasMargin:       conf.GasMargin,
+		ReverseRecords:  conf.ReverseRecords,
+		KeepCustody:     conf.KeepCustody,
+	}
+}
+
+// Close the rpc client. Calls after Close return ErrClosed
+func (e *ENSAdaptor) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	if e.client != nil {
+		e.client.Close()
+	}
+	e.client, e.registry, e.resolvers = nil, nil, nil
 }
 
-func (e *ENSAdaptor) CreateSubdomain(subdomain, receiver string) (string, error) {
+func (e *ENSAdaptor) connection() (chainClient, *ens.Registry, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil, nil, ErrClosed
+	}
+	if e.client != nil {
+		return e.client, e.registry, nil
+	}
 	client, err := ethclient.Dial(e.RPCUrl)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
 	registry, err := ens.NewRegistry(client)
 	if err != nil {
-		return "", err
-	}
-	opts, err := e.getTxOptions(client)
-	if err != nil {
-		return "", err
+		client.Close()
+		return nil, nil, err
 	}
-	receiverAddress := common.HexToAddress(receiver)
-	resolverAddress := common.HexToAddress(e.ResolverAddress)
+	e.client, e.registry, e.resolvers = client, registry, make(map[string]*ens.Resolver)
+	return client, registry, nil
+}
 
-	tx, err := registry.SetSubdomainOwner(opts, e.MainDomain, subdomain, receiverAddress)
+// Resolver binding of the name, cached until reconnect
+func (e *ENSAdaptor) resolver(client chainClient, name string) (*ens.Resolver, error) {
+	e.mu.Lock()
+	if e.client == client {
+		if resolver, ok := e.resolvers[name]; ok {
+			e.mu.Unlock()
+			return resolver, nil
+		}
+	}
+	e.mu.Unlock()
+	resolver, err := ens.NewResolver(client, name)
 	if err != nil {
-		return "", err
+		if msg := err.Error(); msg == "unregistered name" || msg == "no resolver" {
+			return nil, fmt.Errorf("%w: %s", ErrNoName, name)
+		}
+		return nil, err
+	}
+	e.mu.Lock()
+	if e.client == client {
+		e.resolvers[name] = resolver
 	}
+	e.mu.Unlock()
+	return resolver, nil
+}
 
-	tx, err = registry.SetResolver(opts, fmt.Sprintf("%s.%s", subdomain, e.MainDomain), resolverAddress)
-	if err != nil {
-		return "", err
+// Drop broken client so the next call dials again
+func (e *ENSAdaptor) reset(client chainClient) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.client != client {
+		return
 	}
+	client.Close()
+	e.client, e.registry, e.resolvers = nil, nil, nil
+}
 
-	return tx.Hash().Hex(), nil
+// Run fn with the shared client, reconnect and retry once on connection error
+func (e *ENSAdaptor) call(fn func(client chainClient, registry *ens.Registry) error) error {
+	for attempt := 0; ; attempt++ {
+		client, registry, err := e.connection()
+		if err != nil {
+			return err
+		}
+		err = fn(client, registry)
+		if err == nil || attempt > 0 || !isConnectionError(err) {
+			return err
+		}
+		e.reset(client)
+	}
 }
 
-func (e *ENSAdaptor) CreateAvatar(avatarUrl, nick string) (string, error) {
-	client, err := ethclient.Dial(e.RPCUrl)
+// Run ENS write with the shared client. Writes are not retried to avoid duplicate transactions,
+// broken client is dropped so the next call dials again
+func (e *ENSAdaptor) write(fn func(client chainClient, registry *ens.Registry) error) error {
+	client, registry, err := e.connection()
 	if err != nil {
-		return "", err
+		return err
+	}
+	err = fn(client, registry)
+	if err != nil && isConnectionError(err) {
+		e.reset(client)
 	}
+	return err
+}
 
-	opts, err := e.getTxOptions(client)
-	if err != nil {
-		return "", err
+// Send dynamic fee transaction with the next nonce of the signer and wait for confirmations.
+// Gas limit is estimated per call with GasMargin on top.
+// Transaction not mined within ResubmitAfter is sent again with a bumped fee.
+// Transaction of the journal left by an interrupted write is waited for instead of sending a new one
+func (e *ENSAdaptor) transact(client chainClient, journal *Journal, action string, send func(opts *bind.TransactOpts) (*types.Transaction, error)) (record TxRecord, err error) {
+	index := journal.next
+	journal.next++
+	if index < len(journal.Txs) {
+		switch record = journal.Txs[index]; record.Status {
+		case TxConfirmed:
+			return record, nil
+		case TxReverted:
+			return record, &RevertError{Tx: record, Reason: "reverted before the write was resumed"}
+		}
+	}
+
+	timeout := e.ConfirmTimeout
+	if timeout == 0 {
+		timeout = defaultConfirmTimeout
 	}
-	resolver, err := ens.NewResolver(client, e.MainDomain)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	opts, err := e.getTxOptions(ctx, client)
 	if err != nil {
-		return "", err
+		return record, err
 	}
-	tx, err := resolver.SetText(opts, "avatar", avatarUrl)
 
-	return tx.Hash().Hex(), err
-}
-func (e *ENSAdaptor) ResolveAvatar(address string) (avatar string, err error) {
-	client, err := ethclient.Dial(e.RPCUrl)
-	if err != nil {
-		return
+	var sent []*types.Transaction
+	if index < len(journal.Txs) {
+		if sent, err = knownTxs(ctx, client, record); err != nil {
+			return record, err
+		}
 	}
+	nonces := signerNonces(opts.From)
+	nonces.Lock()
+	if len(sent) > 0 {
+		zap.L().Info("Waiting for ENS transaction of the interrupted write", zap.String("hash", record.Hash))
+	} else {
+		nonce, err := nonces.nonce(ctx, client)
+		if err != nil {
+			nonces.Unlock()
+			return record, err
+		}
+		opts.Nonce = new(big.Int).SetUint64(nonce)
+		tx, err := send(opts)
+		if err == nil {
+			tx, err = opts.Signer(opts.From, withGasMargin(tx, e.GasMargin))
+		}
+		if err == nil {
+			err = client.SendTransaction(ctx, tx)
+		}
+		if err != nil {
+			nonces.Unlock()
+			return record, err
+		}
+		record = newTxRecord(tx, action)
+		sent = []*types.Transaction{tx}
+	}
+	nonces.sent(sent[0])
+	nonces.Unlock()
+	defer nonces.done(sent[0].Nonce())
+	journal.save(index, record)
+	defer func() { journal.save(index, record) }()
+
+	resubmitAfter := e.ResubmitAfter
+	if resubmitAfter == 0 {
+		resubmitAfter = defaultResubmitAfter
+	}
+	stale := false
+	for {
+		wait, cancelWait := context.WithTimeout(ctx, resubmitAfter)
+		record, err = confirm(wait, client, opts.From, sent, record, e.Confirmations)
+		cancelWait()
+		if !errors.Is(err, ErrConfirmTimeout) || ctx.Err() != nil {
+			return record, err
+		}
+		if record.BlockNumber != 0 {
+			// Mined, waiting for confirmations
+			continue
+		}
+		if stale {
+			return record, fmt.Errorf("%w: %s", ErrTxDropped, record.Hash)
+		}
+		replacement, err := e.replace(ctx, client, opts, sent[len(sent)-1])
+		if isNonceTooLow(err) {
+			// Mined meanwhile or nonce taken by another transaction, last check on the next round
+			stale = true
+			continue
+		}
+		if err != nil {
+			zap.L().Warn("ENS transaction resubmit error", zap.String("hash", record.Hash), zap.Error(err))
+			continue
+		}
+		zap.L().Info("ENS transaction replaced by fee", zap.String("hash", record.Hash), zap.String("replacement", replacement.Hash().Hex()))
+		record.Replaced = append(record.Replaced, record.Hash)
+		record.Hash = replacement.Hash().Hex()
+		sent = append(sent, replacement)
+		journal.save(index, record)
+	}
+}
 
-	resolver, err := ens.NewResolver(client, e.MainDomain)
+// Send the transaction again with a bumped fee
+func (e *ENSAdaptor) replace(ctx context.Context, client chainClient, opts *bind.TransactOpts, tx *types.Transaction) (*types.Transaction, error) {
+	suggested, err := client.SuggestGasPrice(ctx)
 	if err != nil {
-		return
+		return nil, err
 	}
-	avatar, err = resolver.Text("avatar")
+	replacement, err := opts.Signer(opts.From, bumpFee(tx, suggested))
 	if err != nil {
-		return
+		return nil, err
+	}
+	if err := e.checkFeeCap(replacement); err != nil {
+		return nil, err
+	}
+	if err := client.SendTransaction(ctx, replacement); err != nil {
+		return nil, err
 	}
+	return replacement, nil
+}
+
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, rpc.ErrClientQuit) || errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// Register subdomain with the resolver and point it to the receiver address, ErrNameTaken if
+// another address holds it. Root owner owns the subdomain in the registry until HandOverSubdomain,
+// so it can set the records of the new card. Returns all sent transactions
+func (e *ENSAdaptor) CreateSubdomain(subdomain, receiver string, journal *Journal) ([]TxRecord, error) {
+	journal = journal.start()
+	err := e.write(func(client chainClient, registry *ens.Registry) error {
+		name := e.Subdomain(subdomain)
+		ownerAddress := common.HexToAddress(e.OwnerAddress)
+		resolverAddress := common.HexToAddress(e.ResolverAddress)
+
+		// Never take over a name of another address
+		if err := e.checkHolder(client, registry, name, receiver); err != nil {
+			return err
+		}
 
+		_, err := e.transact(client, journal, ActionSetSubdomainOwner, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return registry.SetSubdomainOwner(opts, e.MainDomain, subdomain, ownerAddress)
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = e.transact(client, journal, ActionSetResolver, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return registry.SetResolver(opts, name, resolverAddress)
+		})
+		if err != nil {
+			return err
+		}
+
+		resolver, err := ens.NewResolverAt(client, name, resolverAddress)
+		if err != nil {
+			return err
+		}
+		_, err = e.transact(client, journal, ActionSetAddr, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return resolver.SetAddress(opts, common.HexToAddress(receiver))
+		})
+		return err
+	})
+	return journal.Txs, err
+}
+
+// Transfer subdomain ownership to the receiver address. Root owner can't manage its records after that
+func (e *ENSAdaptor) HandOverSubdomain(subdomain, receiver string, journal *Journal) ([]TxRecord, error) {
+	journal = journal.start()
+	err := e.write(func(client chainClient, registry *ens.Registry) error {
+		_, err := e.transact(client, journal, ActionSetSubdomainOwner, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return registry.SetSubdomainOwner(opts, e.MainDomain, subdomain, common.HexToAddress(receiver))
+		})
+		return err
+	})
+	return journal.Txs, err
+}
+
+// Give subdomain back to the root owner and clear its address record
+func (e *ENSAdaptor) ReleaseSubdomain(subdomain string, journal *Journal) ([]TxRecord, error) {
+	journal = journal.start()
+	err := e.write(func(client chainClient, registry *ens.Registry) error {
+		name := e.Subdomain(subdomain)
+		_, err := e.transact(client, journal, ActionSetSubdomainOwner, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return registry.SetSubdomainOwner(opts, e.MainDomain, subdomain, common.HexToAddress(e.OwnerAddress))
+		})
+		if err != nil {
+			return err
+		}
+
+		resolverAddress, err := registry.ResolverAddress(name)
+		if err != nil || resolverAddress == (common.Address{}) {
+			return err
+		}
+		resolver, err := ens.NewResolverAt(client, name, resolverAddress)
+		if err != nil {
+			return err
+		}
+		_, err = e.transact(client, journal, ActionSetAddr, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return resolver.SetAddress(opts, common.Address{})
+		})
+		return err
+	})
+	return journal.Txs, err
+}
+
+// Current owner of the subdomain, zero address if subdomain is not registered
+func (e *ENSAdaptor) SubdomainOwner(subdomain string) (owner string, err error) {
+	err = e.call(func(client chainClient, registry *ens.Registry) error {
+		address, err := registry.Owner(e.Subdomain(subdomain))
+		owner = address.Hex()
+		return err
+	})
+	return
+}
+
+// Address record of the subdomain
+func (e *ENSAdaptor) SubdomainAddress(subdomain string) (address string, err error) {
+	name := e.Subdomain(subdomain)
+	err = e.call(func(client chainClient, registry *ens.Registry) error {
+		resolver, err := e.resolver(client, name)
+		if err != nil {
+			return err
+		}
+		addr, err := resolver.Address()
+		address = addr.Hex()
+		return err
+	})
 	return
 }
 
-func (e *ENSAdaptor) getTxOptions(client *ethclient.Client) (*bind.TransactOpts, error) {
+// Set avatar text record of the user subdomain
+func (e *ENSAdaptor) CreateAvatar(avatarUrl, nick string, journal *Journal) ([]TxRecord, error) {
+	return e.SetText(nick, "avatar", avatarUrl, journal)
+}
+
+// Avatar text record of the user subdomain
+func (e *ENSAdaptor) ResolveAvatar(nick string) (string, error) {
+	return e.Text(nick, "avatar")
+}
+
+// Transaction options priced from fee history. Transactions are built and signed
+// but not sent, transact adds the gas margin and sends them
+func (e *ENSAdaptor) getTxOptions(ctx context.Context, client chainClient) (*bind.TransactOpts, error) {
 	from := common.HexToAddress(e.OwnerAddress)
 	key, err := crypto.HexToECDSA(e.PrivateKey)
 	if err != nil {
 		return &bind.TransactOpts{}, err
 	}
-	chainID, err := client.NetworkID(context.Background())
+	chainID, err := client.ChainID(ctx)
 	if err != nil {
 		return &bind.TransactOpts{}, err
-
 	}
-	gasPrice, err := client.SuggestGasPrice(context.Background())
+	tip, feeCap, err := e.fees(ctx, client)
 	if err != nil {
 		return &bind.TransactOpts{}, err
 	}
-	gasPrice = big.NewInt(1502287099)
 
 	signer := KeySigner(chainID, key)
 
 	return &bind.TransactOpts{
-		From:     from,
-		Signer:   signer,
-		GasPrice: gasPrice,
-		Value:    big.NewInt(0),
-		GasLimit: 390000,
+		From:      from,
+		Signer:    signer,
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Value:     big.NewInt(0),
+		Context:   ctx,
+		NoSend:    true,
 	}, nil
 }
 
@@ -123,7 +479,7 @@ func KeySigner(chainID *big.Int, key *ecdsa.PrivateKey) (signerfn bind.SignerFn)
 		if address != keyAddr {
 			return nil, errors.New("not authorized to sign this account")
 		}
-		return types.SignTx(tx, types.NewEIP155Signer(chainID), key)
+		return types.SignTx(tx, types.LatestSignerForChainID(chainID), key)
 	}
 
 	return
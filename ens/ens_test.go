@@ -1,6 +1,10 @@
 package ens
 
-import "testing"
+import (
+	"errors"
+	"net"
+	"testing"
+)
 
 func TestCreateSubdomain(t *testing.T) {
 	ensService := ENSAdaptor{
@@ -10,11 +14,29 @@ func TestCreateSubdomain(t *testing.T) {
 		RPCUrl:          "https://eth-goerli.g.alchemy.com/v2/wnn2ogm_fc2xS605Ja6LaINbBuYWovzb",
 		ResolverAddress: "0xd7a4F6473f32aC2Af804B3686AE8F1932bC35750",
 	}
-	hash, err := ensService.CreateSubdomain("first", "0xa67f7826C808d836ca7aE99d3aa183b7E6DCC3B2")
+	txs, err := ensService.CreateSubdomain("first", "0xa67f7826C808d836ca7aE99d3aa183b7E6DCC3B2", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if hash == "" {
-		t.Errorf("Hash should be not empty")
+	if len(txs) != 3 || txs[0].Hash == "" || txs[2].Action != ActionSetAddr || txs[2].Status != TxConfirmed {
+		t.Errorf("Expected three confirmed transactions, got %+v", txs)
+	}
+}
+
+func TestClosedService(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + listener.Addr().String()
+	listener.Close()
+
+	ensService := NewENSAdaptor(Config{MainDomain: "promisecard.eth", RPCUrl: url})
+	if _, err := ensService.ResolveAvatar(""); !isConnectionError(err) {
+		t.Fatalf("Expected connection error, got %v", err)
+	}
+	ensService.Close()
+	if _, err := ensService.ResolveAvatar(""); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Expected ErrClosed, got %v", err)
 	}
 }
@@ -0,0 +1,102 @@
+package ens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	feeHistoryBlocks     = 10
+	feeHistoryPercentile = 50
+	defaultGasMargin     = 1.2
+)
+
+var ErrFeeTooHigh = errors.New("network fee is above the configured cap")
+
+// Chain access needed to price transactions
+type feeBackend interface {
+	FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error)
+	SuggestGasTipCap(ctx context.Context) (*big.Int, error)
+}
+
+// Tip is the median priority fee of recent blocks, fee cap is twice the next base fee plus tip
+// so the transaction stays valid for several full blocks. Both are limited by MaxGasTipCap and MaxGasFeeCap,
+// ErrFeeTooHigh is returned when the next block can not be paid within the caps
+func (e *ENSAdaptor) fees(ctx context.Context, backend feeBackend) (tip, feeCap *big.Int, err error) {
+	history, err := backend.FeeHistory(ctx, feeHistoryBlocks, nil, []float64{feeHistoryPercentile})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(history.BaseFee) == 0 {
+		return nil, nil, errors.New("empty fee history")
+	}
+	// Last base fee is the base fee of the next block
+	baseFee := history.BaseFee[len(history.BaseFee)-1]
+
+	if tip = medianReward(history.Reward); tip == nil {
+		if tip, err = backend.SuggestGasTipCap(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	if e.MaxGasTipCap != nil && tip.Cmp(e.MaxGasTipCap) > 0 {
+		tip = new(big.Int).Set(e.MaxGasTipCap)
+	}
+
+	feeCap = new(big.Int).Mul(baseFee, big.NewInt(2))
+	feeCap.Add(feeCap, tip)
+	if e.MaxGasFeeCap != nil {
+		if required := new(big.Int).Add(baseFee, tip); required.Cmp(e.MaxGasFeeCap) > 0 {
+			return nil, nil, fmt.Errorf("%w: need %v wei, cap %v wei", ErrFeeTooHigh, required, e.MaxGasFeeCap)
+		}
+		if feeCap.Cmp(e.MaxGasFeeCap) > 0 {
+			feeCap = new(big.Int).Set(e.MaxGasFeeCap)
+		}
+	}
+	return tip, feeCap, nil
+}
+
+// Replacement fee cap must stay within MaxGasFeeCap
+func (e *ENSAdaptor) checkFeeCap(tx *types.Transaction) error {
+	if e.MaxGasFeeCap != nil && tx.GasFeeCap().Cmp(e.MaxGasFeeCap) > 0 {
+		return fmt.Errorf("%w: fee cap %v wei, cap %v wei", ErrFeeTooHigh, tx.GasFeeCap(), e.MaxGasFeeCap)
+	}
+	return nil
+}
+
+// Median of non zero rewards, nil if there are none
+func medianReward(rewards [][]*big.Int) *big.Int {
+	var values []*big.Int
+	for _, block := range rewards {
+		if len(block) > 0 && block[0] != nil && block[0].Sign() > 0 {
+			values = append(values, block[0])
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Cmp(values[j]) < 0 })
+	return new(big.Int).Set(values[len(values)/2])
+}
+
+// Same dynamic fee transaction with the estimated gas limit multiplied by the margin
+func withGasMargin(tx *types.Transaction, margin float64) *types.Transaction {
+	if margin == 0 {
+		margin = defaultGasMargin
+	}
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   tx.ChainId(),
+		Nonce:     tx.Nonce(),
+		GasTipCap: tx.GasTipCap(),
+		GasFeeCap: tx.GasFeeCap(),
+		Gas:       uint64(float64(tx.Gas()) * margin),
+		To:        tx.To(),
+		Value:     tx.Value(),
+		Data:      tx.Data(),
+	})
+}
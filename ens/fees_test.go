@@ -0,0 +1,76 @@
+package ens
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type feeHistory struct {
+	baseFee int64
+	rewards []int64
+}
+
+func (f feeHistory) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	history := &ethereum.FeeHistory{BaseFee: []*big.Int{big.NewInt(1), big.NewInt(f.baseFee)}}
+	for _, reward := range f.rewards {
+		history.Reward = append(history.Reward, []*big.Int{big.NewInt(reward)})
+	}
+	return history, nil
+}
+
+func (f feeHistory) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(7), nil
+}
+
+func TestFees(t *testing.T) {
+	ctx := context.Background()
+	e := NewENSAdaptor(Config{})
+
+	tip, feeCap, err := e.fees(ctx, feeHistory{baseFee: 100, rewards: []int64{0, 5, 1, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tip.Int64() != 3 || feeCap.Int64() != 203 {
+		t.Fatalf("Unexpected tip %v fee cap %v", tip, feeCap)
+	}
+
+	// Empty blocks, tip from the node
+	if tip, _, _ = e.fees(ctx, feeHistory{baseFee: 100, rewards: []int64{0}}); tip.Int64() != 7 {
+		t.Fatalf("Expected suggested tip, got %v", tip)
+	}
+
+	e = NewENSAdaptor(Config{MaxGasFeeCap: big.NewInt(150), MaxGasTipCap: big.NewInt(2)})
+	tip, feeCap, err = e.fees(ctx, feeHistory{baseFee: 100, rewards: []int64{5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tip.Int64() != 2 || feeCap.Int64() != 150 {
+		t.Fatalf("Unexpected capped tip %v fee cap %v", tip, feeCap)
+	}
+	if _, _, err = e.fees(ctx, feeHistory{baseFee: 149, rewards: []int64{5}}); !errors.Is(err, ErrFeeTooHigh) {
+		t.Fatalf("Expected ErrFeeTooHigh, got %v", err)
+	}
+
+	replacement := types.NewTx(&types.DynamicFeeTx{GasTipCap: big.NewInt(2), GasFeeCap: big.NewInt(165)})
+	if err := e.checkFeeCap(replacement); !errors.Is(err, ErrFeeTooHigh) {
+		t.Fatalf("Expected ErrFeeTooHigh, got %v", err)
+	}
+}
+
+func TestGasMargin(t *testing.T) {
+	to := common.HexToAddress("0x0000000000000000000000000000000000000002")
+	tx := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(5), Nonce: 4, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(10), Gas: 50000, To: &to, Data: []byte{1}})
+	if gas := withGasMargin(tx, 0).Gas(); gas != 60000 {
+		t.Fatalf("Expected default margin, got %v", gas)
+	}
+	withMargin := withGasMargin(tx, 1.5)
+	if withMargin.Gas() != 75000 || withMargin.Nonce() != 4 || withMargin.GasFeeCap().Int64() != 10 || *withMargin.To() != to {
+		t.Fatalf("Unexpected transaction %+v", withMargin)
+	}
+}
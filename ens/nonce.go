@@ -0,0 +1,120 @@
+package ens
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Replacement must pay at least 10% more, geth txpool default
+const priceBump = 10
+
+var ErrTxDropped = errors.New("transaction dropped, nonce used by another transaction")
+
+var (
+	noncesMu sync.Mutex
+	nonces   = make(map[common.Address]*nonceManager)
+)
+
+// Chain access needed to pick nonces
+type nonceBackend interface {
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+}
+
+// Nonce manager of one signer. Lock is held from picking the nonce until the
+// transaction is sent, so writes of the signer get consecutive nonces
+type nonceManager struct {
+	sync.Mutex
+	from     common.Address
+	next     uint64
+	inflight map[uint64]struct{}
+}
+
+// Shared nonce manager of the signer
+func signerNonces(from common.Address) *nonceManager {
+	noncesMu.Lock()
+	defer noncesMu.Unlock()
+	n, ok := nonces[from]
+	if !ok {
+		n = &nonceManager{from: from, inflight: make(map[uint64]struct{})}
+		nonces[from] = n
+	}
+	return n
+}
+
+// Next nonce of the signer, must be called with the lock held.
+// Local counter is used while own transactions are in flight because the node may not see them yet,
+// otherwise the pending nonce of the node is used so dropped nonces are reused
+func (n *nonceManager) nonce(ctx context.Context, backend nonceBackend) (uint64, error) {
+	pending, err := backend.PendingNonceAt(ctx, n.from)
+	if err != nil {
+		return 0, err
+	}
+	if len(n.inflight) == 0 || pending > n.next {
+		n.next = pending
+	}
+	return n.next, nil
+}
+
+// Mark nonce as used by the sent transaction, must be called with the lock held
+func (n *nonceManager) sent(tx *types.Transaction) {
+	n.inflight[tx.Nonce()] = struct{}{}
+	if tx.Nonce() >= n.next {
+		n.next = tx.Nonce() + 1
+	}
+}
+
+// Transaction with the nonce is mined or abandoned
+func (n *nonceManager) done(nonce uint64) {
+	n.Lock()
+	defer n.Unlock()
+	delete(n.inflight, nonce)
+}
+
+// Same transaction with the fee bumped by priceBump percent, at least the suggested price
+func bumpFee(tx *types.Transaction, suggested *big.Int) *types.Transaction {
+	bump := func(price, floor *big.Int) *big.Int {
+		bumped := new(big.Int).Mul(price, big.NewInt(100+priceBump))
+		bumped.Div(bumped, big.NewInt(100))
+		bumped.Add(bumped, big.NewInt(1))
+		if floor != nil && bumped.Cmp(floor) < 0 {
+			return new(big.Int).Set(floor)
+		}
+		return bumped
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		tip := bump(tx.GasTipCap(), nil)
+		feeCap := bump(tx.GasFeeCap(), suggested)
+		if feeCap.Cmp(tip) < 0 {
+			feeCap = tip
+		}
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:   tx.ChainId(),
+			Nonce:     tx.Nonce(),
+			GasTipCap: tip,
+			GasFeeCap: feeCap,
+			Gas:       tx.Gas(),
+			To:        tx.To(),
+			Value:     tx.Value(),
+			Data:      tx.Data(),
+		})
+	}
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    tx.Nonce(),
+		GasPrice: bump(tx.GasPrice(), suggested),
+		Gas:      tx.Gas(),
+		To:       tx.To(),
+		Value:    tx.Value(),
+		Data:     tx.Data(),
+	})
+}
+
+// Node rejected the transaction because the nonce is already mined
+func isNonceTooLow(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "nonce too low")
+}
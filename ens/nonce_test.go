@@ -0,0 +1,70 @@
+package ens
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type pendingNonce uint64
+
+func (p *pendingNonce) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return uint64(*p), nil
+}
+
+func TestNonceManager(t *testing.T) {
+	from := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	n := signerNonces(from)
+	if signerNonces(from) != n {
+		t.Fatal("Expected shared manager of the signer")
+	}
+	ctx := context.Background()
+	node := pendingNonce(3)
+
+	// Two writes in flight while the node does not see them yet
+	for _, want := range []uint64{3, 4} {
+		nonce, err := n.nonce(ctx, &node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nonce != want {
+			t.Fatalf("Expected nonce %v, got %v", want, nonce)
+		}
+		n.sent(types.NewTx(&types.LegacyTx{Nonce: nonce}))
+	}
+
+	// Transaction sent by another process
+	node = 6
+	if nonce, _ := n.nonce(ctx, &node); nonce != 6 {
+		t.Fatalf("Expected nonce 6, got %v", nonce)
+	}
+
+	// Dropped transactions, nonce of the node is used again when nothing is in flight
+	n.done(3)
+	n.done(4)
+	node = 3
+	if nonce, _ := n.nonce(ctx, &node); nonce != 3 {
+		t.Fatalf("Expected nonce 3, got %v", nonce)
+	}
+}
+
+func TestBumpFee(t *testing.T) {
+	to := common.HexToAddress("0x0000000000000000000000000000000000000002")
+	legacy := types.NewTx(&types.LegacyTx{Nonce: 1, To: &to, Gas: 21000, GasPrice: big.NewInt(1000), Data: []byte{1}})
+	bumped := bumpFee(legacy, big.NewInt(900))
+	if bumped.GasPrice().Int64() != 1101 || bumped.Nonce() != 1 || bumped.Gas() != 21000 || *bumped.To() != to {
+		t.Fatalf("Unexpected replacement %+v", bumped)
+	}
+	if bumped = bumpFee(legacy, big.NewInt(5000)); bumped.GasPrice().Int64() != 5000 {
+		t.Fatalf("Expected suggested price, got %v", bumped.GasPrice())
+	}
+
+	dynamic := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(5), Nonce: 2, GasTipCap: big.NewInt(100), GasFeeCap: big.NewInt(1000), Gas: 21000, To: &to})
+	bumped = bumpFee(dynamic, nil)
+	if bumped.Type() != types.DynamicFeeTxType || bumped.GasTipCap().Int64() != 111 || bumped.GasFeeCap().Int64() != 1101 {
+		t.Fatalf("Unexpected replacement tip %v fee cap %v", bumped.GasTipCap(), bumped.GasFeeCap())
+	}
+}
@@ -0,0 +1,94 @@
+package ens
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	ens "github.com/wealdtech/go-ens/v3"
+)
+
+var (
+	ErrBadLabel  = errors.New("bad name label")
+	ErrNameTaken = errors.New("name is already taken")
+)
+
+// Normalized subdomain label. Labels of ASCII letters, digits, hyphens and leading underscores are
+// accepted and uppercase letters are mapped to lowercase. ENSIP-15 normalizes such labels to themselves
+// when the underscores are leading and there is no "--" at the third and fourth position,
+// so the registered name is the name ENSIP-15 clients resolve.
+// Other labels are refused: emoji and non-ASCII scripts need the ENSIP-15 data tables and
+// confusable checks of a full implementation such as github.com/adraffy/go-ens-normalize
+func NormalizeLabel(label string) (string, error) {
+	if label == "" {
+		return "", fmt.Errorf("%w: empty label", ErrBadLabel)
+	}
+	leading := true
+	for _, r := range label {
+		if r >= 'A' && r <= 'Z' {
+			r += 'a' - 'A'
+		}
+		switch {
+		case r == '_':
+			if !leading {
+				return "", fmt.Errorf("%w: underscore is allowed only at the start", ErrBadLabel)
+			}
+			continue
+		case r == '-', r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		default:
+			return "", fmt.Errorf("%w: unsupported character %q", ErrBadLabel, r)
+		}
+		leading = false
+	}
+	normalized := strings.ToLower(label)
+	if len(normalized) >= 4 && normalized[2:4] == "--" {
+		return "", fmt.Errorf("%w: \"--\" at the third position", ErrBadLabel)
+	}
+	return normalized, nil
+}
+
+// Subdomain can be created: it is not registered, or the root owner keeps it without an address record
+func (e *ENSAdaptor) SubdomainAvailable(subdomain string) (available bool, err error) {
+	err = e.call(func(client chainClient, registry *ens.Registry) error {
+		holder, err := e.holder(client, registry, e.Subdomain(subdomain))
+		available = holder == (common.Address{})
+		return err
+	})
+	return
+}
+
+// ErrNameTaken when the name is held by an address other than the receiver.
+// Retry for the same receiver is fine
+func (e *ENSAdaptor) checkHolder(client bind.ContractBackend, registry *ens.Registry, name, receiver string) error {
+	holder, err := e.holder(client, registry, name)
+	if err != nil {
+		return err
+	}
+	if holder != (common.Address{}) && holder != common.HexToAddress(receiver) {
+		return fmt.Errorf("%w: %s", ErrNameTaken, name)
+	}
+	return nil
+}
+
+// Address that holds the name: the owner other than the root owner, or the address record
+// of the name kept by the root owner. Zero address when the name is free
+func (e *ENSAdaptor) holder(client bind.ContractBackend, registry *ens.Registry, name string) (common.Address, error) {
+	owner, err := registry.Owner(name)
+	if err != nil || owner == (common.Address{}) {
+		return common.Address{}, err
+	}
+	if owner != common.HexToAddress(e.OwnerAddress) {
+		return owner, nil
+	}
+	resolverAddress, err := registry.ResolverAddress(name)
+	if err != nil || resolverAddress == (common.Address{}) {
+		return common.Address{}, err
+	}
+	resolver, err := ens.NewResolverAt(client, name, resolverAddress)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return resolver.Address()
+}
@@ -0,0 +1,105 @@
+package ens
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	ens "github.com/wealdtech/go-ens/v3"
+	"github.com/wealdtech/go-ens/v3/contracts/registry"
+)
+
+// Contract that returns the storage slot keccak256(calldata) for every call,
+// so view calls are answered from the genesis storage
+var lookupContract = hexutil.MustDecode("0x366000600037366000205460005260206000f3")
+
+// ENSIP-15 rules of ASCII labels, other labels are refused until a full implementation is used
+func TestNormalizeLabel(t *testing.T) {
+	for label, want := range map[string]string{
+		"alice":   "alice",
+		"Alice":   "alice",
+		"__bob":   "__bob",
+		"_":       "_",
+		"a-b-1":   "a-b-1",
+		"-a-":     "-a-",
+		"ab-c":    "ab-c",
+		"a--b":    "a--b",
+		"0x1234":  "0x1234",
+		"PROMISE": "promise",
+	} {
+		got, err := NormalizeLabel(label)
+		if err != nil || got != want {
+			t.Errorf("NormalizeLabel(%q) = %q, %v", label, got, err)
+		}
+	}
+	for _, label := range []string{
+		// Invalid in ENSIP-15
+		"", "a.b", "a_b", "a_", "ab--c", "xn--80ak6aa92e", "XN--80AK6AA92E", "hi!", "a b", "ab\u00ad", "a\u200db",
+		// Valid in ENSIP-15 but refused
+		"ＡＬＩＣＥ", "café", "straße", "иван", "東京たワー", "💩", "\u212aelvin",
+	} {
+		if got, err := NormalizeLabel(label); !errors.Is(err, ErrBadLabel) {
+			t.Errorf("Expected ErrBadLabel for %q, got %q %v", label, got, err)
+		}
+	}
+}
+
+func TestCheckHolder(t *testing.T) {
+	root := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	alice := common.HexToAddress("0x2000000000000000000000000000000000000002")
+	bob := common.HexToAddress("0x3000000000000000000000000000000000000003")
+	resolverAddress := common.HexToAddress("0x4000000000000000000000000000000000000004")
+	registryAddress, _ := ens.RegistryContractAddress(nil)
+	registryABI := mustParseABI(registry.ContractABI)
+
+	registryStorage := make(map[common.Hash]common.Hash)
+	resolverStorage := make(map[common.Hash]common.Hash)
+	set := func(storage map[common.Hash]common.Hash, contract abi.ABI, method, name string, value common.Address) {
+		data, err := contract.Pack(method, [32]byte(NameHash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		storage[crypto.Keccak256Hash(data)] = common.BytesToHash(value.Bytes())
+	}
+	// Taken by the owner, kept by the root owner for alice, kept by the root owner without a resolver
+	set(registryStorage, registryABI, "owner", "bob.promisecard.eth", bob)
+	set(registryStorage, registryABI, "owner", "alice.promisecard.eth", root)
+	set(registryStorage, registryABI, "resolver", "alice.promisecard.eth", resolverAddress)
+	set(resolverStorage, resolverABI, "addr", "alice.promisecard.eth", alice)
+	set(registryStorage, registryABI, "owner", "free.promisecard.eth", root)
+
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+		registryAddress: {Code: lookupContract, Storage: registryStorage, Balance: big.NewInt(0)},
+		resolverAddress: {Code: lookupContract, Storage: resolverStorage, Balance: big.NewInt(0)},
+	}, 10_000_000)
+	defer backend.Close()
+	reg, err := ens.NewRegistryAt(backend, registryAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewENSAdaptor(Config{OwnerAddress: root.Hex(), MainDomain: "promisecard.eth"})
+
+	for _, c := range []struct {
+		label    string
+		receiver common.Address
+		taken    bool
+	}{
+		{"new", alice, false},
+		{"free", alice, false},
+		{"bob", alice, true},
+		{"bob", bob, false},
+		{"alice", bob, true},
+		{"alice", alice, false},
+	} {
+		err := service.checkHolder(backend, reg, service.Subdomain(c.label), c.receiver.Hex())
+		if c.taken != errors.Is(err, ErrNameTaken) || (!c.taken && err != nil) {
+			t.Errorf("checkHolder(%s, %s) = %v", c.label, c.receiver.Hex(), err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package ens
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	ens "github.com/wealdtech/go-ens/v3"
+)
+
+var (
+	ErrBadAddress           = errors.New("bad address")
+	ErrReverseNotAuthorized = errors.New("root owner is not a reverse registrar controller")
+)
+
+const reverseRegistrarJSON = `[{"inputs":[{"internalType":"address","name":"","type":"address"}],"name":"controllers","outputs":[{"internalType":"bool","name":"","type":"bool"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address","name":"addr","type":"address"},{"internalType":"address","name":"owner","type":"address"},{"internalType":"address","name":"resolver","type":"address"},{"internalType":"string","name":"name","type":"string"}],"name":"setNameForAddr","outputs":[{"internalType":"bytes32","name":"","type":"bytes32"}],"stateMutability":"nonpayable","type":"function"},{"inputs":[],"name":"defaultResolver","outputs":[{"internalType":"contract NameResolver","name":"","type":"address"}],"stateMutability":"view","type":"function"}]`
+
+const registryApprovalJSON = `[{"inputs":[{"internalType":"address","name":"owner","type":"address"},{"internalType":"address","name":"operator","type":"address"}],"name":"isApprovedForAll","outputs":[{"internalType":"bool","name":"","type":"bool"}],"stateMutability":"view","type":"function"}]`
+
+var (
+	reverseRegistrarABI = mustParseABI(reverseRegistrarJSON)
+	registryApprovalABI = mustParseABI(registryApprovalJSON)
+)
+
+// Address, avatar and text records of the name
+type Resolution struct {
+	Name    string            `json:"name"`
+	Address string            `json:"address"`
+	Avatar  string            `json:"avatar"`
+	Texts   map[string]string `json:"texts"`
+}
+
+// Subdomain label from the label or the full name under the main domain
+func (e *ENSAdaptor) Label(name string) (string, error) {
+	label := strings.TrimSuffix(name, "."+e.MainDomain)
+	if label == "" || strings.Contains(label, ".") {
+		return "", fmt.Errorf("%w: %s", ErrNoName, name)
+	}
+	return label, nil
+}
+
+// Address, avatar and text records of the subdomain, keys that are not set are omitted
+func (e *ENSAdaptor) Resolve(nick string, keys []string) (resolution Resolution, err error) {
+	resolution.Name = e.Subdomain(nick)
+	err = e.call(func(client chainClient, registry *ens.Registry) error {
+		resolver, err := e.resolver(client, resolution.Name)
+		if err != nil {
+			return err
+		}
+		address, err := resolver.Address()
+		if err != nil {
+			return err
+		}
+		resolution.Address = address.Hex()
+		if resolution.Avatar, err = resolver.Text("avatar"); err != nil {
+			return err
+		}
+		resolution.Texts, err = readTexts(resolver, keys)
+		return err
+	})
+	return
+}
+
+// Primary name of the address. The name counts only when it resolves back to the address
+func (e *ENSAdaptor) ReverseResolve(address string) (name string, err error) {
+	if !common.IsHexAddress(address) {
+		return "", fmt.Errorf("%w: %s", ErrBadAddress, address)
+	}
+	addr := common.HexToAddress(address)
+	err = e.call(func(client chainClient, registry *ens.Registry) error {
+		resolverAddress, err := registry.ResolverAddress(fmt.Sprintf("%x.addr.reverse", addr.Bytes()))
+		if err != nil {
+			return err
+		}
+		if resolverAddress == (common.Address{}) {
+			return fmt.Errorf("%w: no reverse record of %s", ErrNoName, addr.Hex())
+		}
+		reverse, err := ens.NewReverseResolverAt(client, resolverAddress)
+		if err != nil {
+			return err
+		}
+		primary, err := reverse.Name(addr)
+		if err != nil {
+			return err
+		}
+		if primary == "" {
+			return fmt.Errorf("%w: no reverse record of %s", ErrNoName, addr.Hex())
+		}
+		forward, err := ens.Resolve(client, primary)
+		if err != nil {
+			if msg := err.Error(); msg == "unregistered name" || msg == "no resolver" || msg == "no address" {
+				return fmt.Errorf("%w: %s", ErrNoName, primary)
+			}
+			return err
+		}
+		if forward != addr {
+			return fmt.Errorf("%w: %s resolves to %s", ErrNoName, primary, forward.Hex())
+		}
+		name = primary
+		return nil
+	})
+	return
+}
+
+// Set reverse record of the card address to the name. The root owner sends setNameForAddr,
+// so card addresses need no funds. The reverse registrar accepts it only from its controllers
+// or operators approved by the address, ErrReverseNotAuthorized is returned without sending
+// the transaction otherwise
+func (e *ENSAdaptor) SetReverseName(address, name string, journal *Journal) ([]TxRecord, error) {
+	if !common.IsHexAddress(address) {
+		return nil, fmt.Errorf("%w: %s", ErrBadAddress, address)
+	}
+	addr := common.HexToAddress(address)
+	journal = journal.start()
+	err := e.write(func(client chainClient, registry *ens.Registry) error {
+		registrar, resolverAddress, err := e.reverseRegistrar(client, registry, addr)
+		if err != nil {
+			return err
+		}
+		_, err = e.transact(client, journal, ActionSetReverse, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return registrar.Transact(opts, "setNameForAddr", addr, addr, resolverAddress, name)
+		})
+		return err
+	})
+	return journal.Txs, err
+}
+
+// Reverse registrar that accepts setNameForAddr of the address from the root owner and its default resolver
+func (e *ENSAdaptor) reverseRegistrar(client bind.ContractBackend, registry *ens.Registry, addr common.Address) (*bind.BoundContract, common.Address, error) {
+	registrarAddress, err := registry.Owner("addr.reverse")
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	if registrarAddress == (common.Address{}) {
+		return nil, common.Address{}, errors.New("no reverse registrar")
+	}
+	registrar := bind.NewBoundContract(registrarAddress, reverseRegistrarABI, client, client, client)
+	owner := common.HexToAddress(e.OwnerAddress)
+	authorized, err := callBool(registrar, "controllers", owner)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	if !authorized {
+		approvals := bind.NewBoundContract(registry.ContractAddr, registryApprovalABI, client, client, client)
+		if authorized, err = callBool(approvals, "isApprovedForAll", addr, owner); err != nil {
+			return nil, common.Address{}, err
+		}
+	}
+	if !authorized {
+		return nil, common.Address{}, fmt.Errorf("%w: %s", ErrReverseNotAuthorized, owner.Hex())
+	}
+	var out []interface{}
+	if err := registrar.Call(nil, &out, "defaultResolver"); err != nil {
+		return nil, common.Address{}, err
+	}
+	return registrar, *abi.ConvertType(out[0], new(common.Address)).(*common.Address), nil
+}
+
+func callBool(contract *bind.BoundContract, method string, args ...interface{}) (bool, error) {
+	var out []interface{}
+	if err := contract.Call(nil, &out, method, args...); err != nil {
+		return false, err
+	}
+	return *abi.ConvertType(out[0], new(bool)).(*bool), nil
+}
+
+func readTexts(resolver *ens.Resolver, keys []string) (map[string]string, error) {
+	records := make(map[string]string)
+	for _, key := range keys {
+		value, err := resolver.Text(key)
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			records[key] = value
+		}
+	}
+	return records, nil
+}
@@ -0,0 +1,319 @@
+package ens
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	ens "github.com/wealdtech/go-ens/v3"
+	"github.com/wealdtech/go-ens/v3/contracts/registry"
+	"github.com/wealdtech/go-ens/v3/contracts/reverseresolver"
+)
+
+func TestLabel(t *testing.T) {
+	e := NewENSAdaptor(Config{MainDomain: "promisecard.eth"})
+	for name, want := range map[string]string{"alice": "alice", "alice.promisecard.eth": "alice"} {
+		if label, err := e.Label(name); err != nil || label != want {
+			t.Errorf("Label(%q) = %q, %v", name, label, err)
+		}
+	}
+	for _, name := range []string{"", "promisecard.eth", "alice.other.eth", "a.b.promisecard.eth"} {
+		if _, err := e.Label(name); !errors.Is(err, ErrNoName) {
+			t.Errorf("Expected ErrNoName for %q, got %v", name, err)
+		}
+	}
+	if _, err := e.ReverseResolve("0x123"); !errors.Is(err, ErrBadAddress) {
+		t.Errorf("Expected ErrBadAddress, got %v", err)
+	}
+	if _, err := e.SetReverseName("0x123", "alice.promisecard.eth", nil); !errors.Is(err, ErrBadAddress) {
+		t.Errorf("Expected ErrBadAddress, got %v", err)
+	}
+	if _, err := reverseRegistrarABI.Pack("setNameForAddr", common.Address{1}, common.Address{1}, common.Address{2}, "alice.promisecard.eth"); err != nil {
+		t.Error(err)
+	}
+}
+
+var (
+	registryContractABI        = mustParseABI(registry.ContractABI)
+	reverseResolverContractABI = mustParseABI(reverseresolver.ContractABI)
+)
+
+// Contract that answers every call with the words stored for keccak256(calldata):
+// the word count in the hash slot and the words in the following slots, one zero word if not set
+var returnContract = hexutil.MustDecode("0x366000600037366000208054600060005260005b81811015602d578083016001015481602002526001016013565b818015016020026000f3")
+
+// Storage answering the call of the method with the outputs
+func setReturn(t *testing.T, storage map[common.Hash]common.Hash, contract abi.ABI, method string, args []interface{}, outputs ...interface{}) {
+	t.Helper()
+	call, err := contract.Pack(method, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := contract.Methods[method].Outputs.Pack(outputs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slot := crypto.Keccak256Hash(call).Big()
+	words := (len(out) + 31) / 32
+	storage[common.BigToHash(slot)] = common.BigToHash(big.NewInt(int64(words)))
+	for i := 0; i < words; i++ {
+		word := make([]byte, 32)
+		copy(word, out[i*32:])
+		storage[common.BigToHash(new(big.Int).Add(slot, big.NewInt(int64(i+1))))] = common.BytesToHash(word)
+	}
+}
+
+// Simulated backend with the chain id and fee history of the ENS service client
+type simulatedClient struct {
+	*backends.SimulatedBackend
+}
+
+func (c simulatedClient) ChainID(ctx context.Context) (*big.Int, error) {
+	return c.Blockchain().Config().ChainID, nil
+}
+
+func (c simulatedClient) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	header, err := c.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &ethereum.FeeHistory{BaseFee: []*big.Int{header.BaseFee, header.BaseFee}}, nil
+}
+
+func (c simulatedClient) Close() {
+	c.SimulatedBackend.Close()
+}
+
+// ENS deployment on the simulated chain: registry, public resolver, reverse registrar and reverse resolver
+type simulatedENS struct {
+	root, alice, bob   common.Address
+	rootKey            string
+	registrar, reverse common.Address
+	registry           map[common.Hash]common.Hash
+	resolver           map[common.Hash]common.Hash
+	registrarStorage   map[common.Hash]common.Hash
+	reverseStorage     map[common.Hash]common.Hash
+}
+
+func newSimulatedENS() *simulatedENS {
+	key, _ := crypto.GenerateKey()
+	return &simulatedENS{
+		root:             crypto.PubkeyToAddress(key.PublicKey),
+		rootKey:          hex.EncodeToString(crypto.FromECDSA(key)),
+		alice:            common.HexToAddress("0x2Ab0000000000000000000000000000000000Fe2"),
+		bob:              common.HexToAddress("0x3cD0000000000000000000000000000000000Ba3"),
+		registrar:        common.HexToAddress("0x5000000000000000000000000000000000000005"),
+		reverse:          common.HexToAddress("0x6000000000000000000000000000000000000006"),
+		registry:         make(map[common.Hash]common.Hash),
+		resolver:         make(map[common.Hash]common.Hash),
+		registrarStorage: make(map[common.Hash]common.Hash),
+		reverseStorage:   make(map[common.Hash]common.Hash),
+	}
+}
+
+// Service connected to the simulated chain
+func (s *simulatedENS) service(t *testing.T) (*ENSAdaptor, *backends.SimulatedBackend) {
+	t.Helper()
+	registryAddress, _ := ens.RegistryContractAddress(nil)
+	resolverAddress := common.HexToAddress("0x4000000000000000000000000000000000000004")
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+		s.root:          {Balance: big.NewInt(1e18)},
+		registryAddress: {Code: returnContract, Storage: s.registry, Balance: big.NewInt(0)},
+		resolverAddress: {Code: returnContract, Storage: s.resolver, Balance: big.NewInt(0)},
+		s.registrar:     {Code: returnContract, Storage: s.registrarStorage, Balance: big.NewInt(0)},
+		s.reverse:       {Code: returnContract, Storage: s.reverseStorage, Balance: big.NewInt(0)},
+	}, 10_000_000)
+	t.Cleanup(func() { backend.Close() })
+	registry, err := ens.NewRegistryAt(backend, registryAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewENSAdaptor(Config{OwnerAddress: s.root.Hex(), PrivateKey: s.rootKey, MainDomain: "promisecard.eth"})
+	service.client, service.registry, service.resolvers = simulatedClient{backend}, registry, make(map[string]*ens.Resolver)
+	return service, backend
+}
+
+func (s *simulatedENS) register(t *testing.T, name string, addr common.Address, texts map[string]string) {
+	t.Helper()
+	resolverAddress := common.HexToAddress("0x4000000000000000000000000000000000000004")
+	node := [32]byte(NameHash(name))
+	setReturn(t, s.registry, registryContractABI, "owner", []interface{}{node}, s.root)
+	setReturn(t, s.registry, registryContractABI, "resolver", []interface{}{node}, resolverAddress)
+	setReturn(t, s.resolver, resolverABI, "addr", []interface{}{node}, addr)
+	for key, value := range texts {
+		setReturn(t, s.resolver, resolverABI, "text", []interface{}{node, key}, value)
+	}
+}
+
+func (s *simulatedENS) setPrimary(t *testing.T, addr common.Address, name string) {
+	t.Helper()
+	node := [32]byte(NameHash(fmt.Sprintf("%x.addr.reverse", addr.Bytes())))
+	setReturn(t, s.registry, registryContractABI, "resolver", []interface{}{node}, s.reverse)
+	setReturn(t, s.reverseStorage, reverseResolverContractABI, "name", []interface{}{node}, name)
+}
+
+func TestResolve(t *testing.T) {
+	sim := newSimulatedENS()
+	sim.register(t, "alice.promisecard.eth", sim.alice, map[string]string{"avatar": "ipfs://cid", "url": "https://alice.example"})
+	service, _ := sim.service(t)
+
+	resolution, err := service.Resolve("alice", []string{"url", "com.twitter"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolution.Name != "alice.promisecard.eth" || resolution.Address != sim.alice.Hex() || resolution.Avatar != "ipfs://cid" {
+		t.Errorf("Unexpected resolution %+v", resolution)
+	}
+	if len(resolution.Texts) != 1 || resolution.Texts["url"] != "https://alice.example" {
+		t.Errorf("Unexpected texts %v", resolution.Texts)
+	}
+	if _, err := service.Resolve("nobody", nil); !errors.Is(err, ErrNoName) {
+		t.Errorf("Expected ErrNoName, got %v", err)
+	}
+}
+
+func TestReverseResolve(t *testing.T) {
+	sim := newSimulatedENS()
+	sim.register(t, "alice.promisecard.eth", sim.alice, nil)
+	sim.setPrimary(t, sim.alice, "alice.promisecard.eth")
+	// Bob claims the name of alice, it doesn't resolve back to bob
+	sim.setPrimary(t, sim.bob, "alice.promisecard.eth")
+	service, _ := sim.service(t)
+
+	if name, err := service.ReverseResolve(sim.alice.Hex()); err != nil || name != "alice.promisecard.eth" {
+		t.Errorf("ReverseResolve(alice) = %q, %v", name, err)
+	}
+	if name, err := service.ReverseResolve(sim.bob.Hex()); !errors.Is(err, ErrNoName) {
+		t.Errorf("Expected ErrNoName for the name resolving to another address, got %q %v", name, err)
+	}
+	if name, err := service.ReverseResolve(sim.root.Hex()); !errors.Is(err, ErrNoName) {
+		t.Errorf("Expected ErrNoName without reverse record, got %q %v", name, err)
+	}
+}
+
+func TestSetReverseName(t *testing.T) {
+	pollInterval := receiptPollInterval
+	receiptPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { receiptPollInterval = pollInterval })
+
+	sim := newSimulatedENS()
+	setReturn(t, sim.registry, registryContractABI, "owner", []interface{}{[32]byte(NameHash("addr.reverse"))}, sim.registrar)
+	setReturn(t, sim.registrarStorage, reverseRegistrarABI, "defaultResolver", nil, sim.reverse)
+
+	// Root owner that is not a controller would be reverted, nothing is sent
+	service, _ := sim.service(t)
+	txs, err := service.SetReverseName(sim.alice.Hex(), "alice.promisecard.eth", nil)
+	if !errors.Is(err, ErrReverseNotAuthorized) || len(txs) != 0 {
+		t.Fatalf("Expected ErrReverseNotAuthorized without transactions, got %v %v", txs, err)
+	}
+
+	setReturn(t, sim.registrarStorage, reverseRegistrarABI, "controllers", []interface{}{sim.root}, true)
+	service, backend := sim.service(t)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				backend.Commit()
+			}
+		}
+	}()
+	txs, err = service.SetReverseName(sim.alice.Hex(), "alice.promisecard.eth", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 1 || txs[0].Action != ActionSetReverse || txs[0].Status != TxConfirmed {
+		t.Fatalf("Unexpected transactions %+v", txs)
+	}
+	tx, _, err := backend.TransactionByHash(context.Background(), common.HexToHash(txs[0].Hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *tx.To() != sim.registrar {
+		t.Errorf("Transaction sent to %s", tx.To().Hex())
+	}
+	args, err := reverseRegistrarABI.Methods["setNameForAddr"].Inputs.Unpack(tx.Data()[4:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args[0] != sim.alice || args[1] != sim.alice || args[2] != sim.reverse || args[3] != "alice.promisecard.eth" {
+		t.Errorf("Unexpected setNameForAddr arguments %v", args)
+	}
+}
+
+func TestResumedWrite(t *testing.T) {
+	pollInterval := receiptPollInterval
+	receiptPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { receiptPollInterval = pollInterval })
+
+	sim := newSimulatedENS()
+	setReturn(t, sim.registry, registryContractABI, "owner", []interface{}{[32]byte(NameHash("addr.reverse"))}, sim.registrar)
+	setReturn(t, sim.registrarStorage, reverseRegistrarABI, "defaultResolver", nil, sim.reverse)
+	setReturn(t, sim.registrarStorage, reverseRegistrarABI, "controllers", []interface{}{sim.root}, true)
+	service, backend := sim.service(t)
+	ctx := context.Background()
+
+	// Write interrupted before its transaction is mined leaves the transaction in the journal
+	service.ConfirmTimeout = 100 * time.Millisecond
+	var saved []TxRecord
+	journal := &Journal{Sent: func(txs []TxRecord) error {
+		saved = append([]TxRecord{}, txs...)
+		return nil
+	}}
+	if _, err := service.SetReverseName(sim.alice.Hex(), "alice.promisecard.eth", journal); !errors.Is(err, ErrConfirmTimeout) {
+		t.Fatalf("Expected ErrConfirmTimeout, got %v", err)
+	}
+	if len(saved) != 1 || saved[0].Status != TxPending {
+		t.Fatalf("Unexpected saved transactions %+v", saved)
+	}
+
+	// Resumed write waits for the sent transaction
+	backend.Commit()
+	txs, err := service.SetReverseName(sim.alice.Hex(), "alice.promisecard.eth", &Journal{Txs: saved})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 1 || txs[0].Hash != saved[0].Hash || txs[0].Status != TxConfirmed {
+		t.Fatalf("Unexpected transactions %+v", txs)
+	}
+	if nonce, err := backend.NonceAt(ctx, sim.root, nil); err != nil || nonce != 1 {
+		t.Fatalf("Expected one transaction, nonce %d %v", nonce, err)
+	}
+
+	// Transaction the node doesn't know is sent again
+	service.ConfirmTimeout = 5 * time.Second
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				backend.Commit()
+			}
+		}
+	}()
+	lost := TxRecord{Hash: common.Hash{1}.Hex(), Action: ActionSetReverse, Nonce: 1, Status: TxPending}
+	txs, err = service.SetReverseName(sim.alice.Hex(), "alice.promisecard.eth", &Journal{Txs: []TxRecord{lost}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 1 || txs[0].Hash == lost.Hash || txs[0].Status != TxConfirmed {
+		t.Fatalf("Unexpected transactions %+v", txs)
+	}
+}
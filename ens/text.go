@@ -0,0 +1,150 @@
+package ens
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	ens "github.com/wealdtech/go-ens/v3"
+	"github.com/wealdtech/go-ens/v3/contracts/resolver"
+)
+
+const multicallJSON = `[{"inputs":[{"internalType":"bytes[]","name":"data","type":"bytes[]"}],"name":"multicall","outputs":[{"internalType":"bytes[]","name":"results","type":"bytes[]"}],"stateMutability":"nonpayable","type":"function"}]`
+
+var ErrBadTextKey = errors.New("unsupported text record key")
+
+// ERC-165 interface id of IMulticallable, the selector of multicall(bytes[])
+var multicallInterfaceID = [4]byte{0xac, 0x96, 0x50, 0xd8}
+
+// ENSIP-5 global keys
+var GlobalTextKeys = []string{"avatar", "description", "display", "email", "keywords", "mail", "notice", "location", "phone", "url", "header"}
+
+// Service keys are reverse dot notation of the service domain, e.g. com.twitter
+var serviceKeyPattern = regexp.MustCompile(`^[a-z0-9-]+(\.[a-z0-9-]+)+$`)
+
+var (
+	resolverABI  = mustParseABI(resolver.ContractABI)
+	multicallABI = mustParseABI(multicallJSON)
+)
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// ENSIP-5 global key or service key
+func ValidTextKey(key string) bool {
+	for _, global := range GlobalTextKeys {
+		if key == global {
+			return true
+		}
+	}
+	return serviceKeyPattern.MatchString(key)
+}
+
+// Full name of the subdomain
+func (e *ENSAdaptor) Subdomain(nick string) string {
+	return fmt.Sprintf("%s.%s", nick, e.MainDomain)
+}
+
+// Set one text record of the subdomain
+func (e *ENSAdaptor) SetText(nick, key, value string, journal *Journal) ([]TxRecord, error) {
+	return e.SetTexts(nick, map[string]string{key: value}, journal)
+}
+
+// Set text records of the subdomain in one multicall transaction, or one transaction per record
+// when the resolver doesn't support multicall. Empty value removes the record
+func (e *ENSAdaptor) SetTexts(nick string, records map[string]string, journal *Journal) ([]TxRecord, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(records))
+	for key := range records {
+		if !ValidTextKey(key) {
+			return nil, fmt.Errorf("%w: %s", ErrBadTextKey, key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	name := e.Subdomain(nick)
+	journal = journal.start()
+	err := e.write(func(client chainClient, registry *ens.Registry) error {
+		resolver, err := e.resolver(client, name)
+		if err != nil {
+			return err
+		}
+		multicall := false
+		if len(keys) > 1 {
+			if multicall, err = supportsMulticall(client, resolver); err != nil {
+				return err
+			}
+		}
+		if !multicall {
+			for _, key := range keys {
+				key := key
+				_, err := e.transact(client, journal, ActionSetText, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+					return resolver.SetText(opts, key, records[key])
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		node := NameHash(name)
+		calls := make([][]byte, 0, len(keys))
+		for _, key := range keys {
+			call, err := resolverABI.Pack("setText", [32]byte(node), key, records[key])
+			if err != nil {
+				return err
+			}
+			calls = append(calls, call)
+		}
+		contract := bind.NewBoundContract(resolver.ContractAddr, multicallABI, client, client, client)
+		_, err = e.transact(client, journal, ActionSetTexts, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return contract.Transact(opts, "multicall", calls)
+		})
+		return err
+	})
+	return journal.Txs, err
+}
+
+// Resolver implements multicall by ERC-165. Resolver without supportsInterface doesn't support it
+func supportsMulticall(client bind.ContractBackend, resolver *ens.Resolver) (bool, error) {
+	contract := bind.NewBoundContract(resolver.ContractAddr, resolverABI, client, client, client)
+	supported, err := callBool(contract, "supportsInterface", multicallInterfaceID)
+	if err != nil && isConnectionError(err) {
+		return false, err
+	}
+	return err == nil && supported, nil
+}
+
+// Text record of the subdomain, empty if not set
+func (e *ENSAdaptor) Text(nick, key string) (string, error) {
+	records, err := e.Texts(nick, []string{key})
+	return records[key], err
+}
+
+// Text records of the subdomain, keys that are not set are omitted
+func (e *ENSAdaptor) Texts(nick string, keys []string) (records map[string]string, err error) {
+	name := e.Subdomain(nick)
+	err = e.call(func(client chainClient, registry *ens.Registry) error {
+		resolver, err := e.resolver(client, name)
+		if err != nil {
+			return err
+		}
+		records, err = readTexts(resolver, keys)
+		return err
+	})
+	return
+}
@@ -0,0 +1,91 @@
+package ens
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestValidTextKey(t *testing.T) {
+	for key, valid := range map[string]bool{
+		"avatar":        true,
+		"url":           true,
+		"com.twitter":   true,
+		"org.telegram":  true,
+		"xyz.farcaster": true,
+		"twitter":       false,
+		"Com.Twitter":   false,
+		"":              false,
+		"com.":          false,
+	} {
+		if ValidTextKey(key) != valid {
+			t.Errorf("ValidTextKey(%q) = %v", key, !valid)
+		}
+	}
+	if name := NewENSAdaptor(Config{MainDomain: "promisecard.eth"}).Subdomain("alice"); name != "alice.promisecard.eth" {
+		t.Errorf("Unexpected subdomain %s", name)
+	}
+}
+
+func TestSetTexts(t *testing.T) {
+	pollInterval := receiptPollInterval
+	receiptPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { receiptPollInterval = pollInterval })
+	if id := multicallABI.Methods["multicall"].ID; !bytes.Equal(id, multicallInterfaceID[:]) {
+		t.Fatalf("Multicall interface id %x, selector %x", multicallInterfaceID, id)
+	}
+
+	records := map[string]string{"url": "https://alice.example", "com.twitter": "alice"}
+	for _, multicall := range []bool{false, true} {
+		sim := newSimulatedENS()
+		sim.register(t, "alice.promisecard.eth", sim.alice, nil)
+		setReturn(t, sim.resolver, resolverABI, "supportsInterface", []interface{}{multicallInterfaceID}, multicall)
+		service, backend := sim.service(t)
+		stop := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-stop:
+					return
+				case <-time.After(10 * time.Millisecond):
+					backend.Commit()
+				}
+			}
+		}()
+		txs, err := service.SetTexts("alice", records, nil)
+		close(stop)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Resolver without multicall gets one setText per record in key order
+		want := []string{ActionSetText, ActionSetText}
+		if multicall {
+			want = []string{ActionSetTexts}
+		}
+		if len(txs) != len(want) {
+			t.Fatalf("Multicall %v: unexpected transactions %+v", multicall, txs)
+		}
+		for i, tx := range txs {
+			if tx.Action != want[i] || tx.Status != TxConfirmed {
+				t.Fatalf("Multicall %v: unexpected transaction %+v", multicall, tx)
+			}
+		}
+		if !multicall {
+			tx, _, err := backend.TransactionByHash(context.Background(), common.HexToHash(txs[0].Hash))
+			if err != nil {
+				t.Fatal(err)
+			}
+			args, err := resolverABI.Methods["setText"].Inputs.Unpack(tx.Data()[4:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if args[1] != "com.twitter" || args[2] != "alice" {
+				t.Errorf("Unexpected setText arguments %v", args)
+			}
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package ens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+)
+
+// Transaction statuses
+const (
+	TxPending   = "pending"
+	TxConfirmed = "confirmed"
+	TxReverted  = "reverted"
+)
+
+// ENS write actions
+const (
+	ActionSetSubdomainOwner = "set_subdomain_owner"
+	ActionSetResolver       = "set_resolver"
+	ActionSetText           = "set_text"
+	ActionSetTexts          = "set_texts"
+	ActionSetAddr           = "set_addr"
+	ActionSetReverse        = "set_reverse"
+)
+
+var receiptPollInterval = time.Second
+
+var ErrConfirmTimeout = errors.New("transaction confirmation timeout")
+
+// Tracked ENS write transaction
+type TxRecord struct {
+	Hash          string   `json:"hash"`
+	Action        string   `json:"action"`
+	Nonce         uint64   `json:"nonce"`
+	Status        string   `json:"status"`
+	BlockNumber   uint64   `json:"block_number"`
+	GasUsed       uint64   `json:"gas_used"`
+	Confirmations uint64   `json:"confirmations"`
+	Replaced      []string `json:"replaced,omitempty"` // hashes of the same write replaced by fee
+}
+
+// Transactions of one ENS write, e.g. a provisioning step. Sent is called with all transactions
+// whenever one is sent, replaced or confirmed, so the caller can save them before the write returns.
+// The write run again with the transactions of an interrupted run waits for their receipts
+// instead of sending them again, only transactions the node doesn't know are sent again
+type Journal struct {
+	Txs  []TxRecord
+	Sent func(txs []TxRecord) error
+
+	next int // index of the next transaction of the running write
+}
+
+// Journal of the new write, nil journal keeps transactions in memory
+func (j *Journal) start() *Journal {
+	if j == nil {
+		return &Journal{}
+	}
+	j.next = 0
+	return j
+}
+
+// Save the transaction record at the index of its write.
+// Transaction is on its way already, so save error is only logged
+func (j *Journal) save(index int, record TxRecord) {
+	if index < len(j.Txs) {
+		j.Txs[index] = record
+	} else {
+		j.Txs = append(j.Txs, record)
+	}
+	if j.Sent == nil {
+		return
+	}
+	if err := j.Sent(j.Txs); err != nil {
+		zap.L().Warn("Save ENS transactions error", zap.String("hash", record.Hash), zap.Error(err))
+	}
+}
+
+// Transaction was mined but reverted
+type RevertError struct {
+	Tx     TxRecord
+	Reason string
+}
+
+func (e *RevertError) Error() string {
+	return fmt.Sprintf("transaction %s (%s) reverted: %s", e.Tx.Hash, e.Tx.Action, e.Reason)
+}
+
+// Chain access needed to track transactions
+type txBackend interface {
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	TransactionByHash(ctx context.Context, txHash common.Hash) (tx *types.Transaction, isPending bool, err error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+}
+
+func newTxRecord(tx *types.Transaction, action string) TxRecord {
+	return TxRecord{
+		Hash:   tx.Hash().Hex(),
+		Action: action,
+		Nonce:  tx.Nonce(),
+		Status: TxPending,
+	}
+}
+
+// Transactions of the record known to the node, the current one last.
+// None when the node dropped them and the write has to be sent again
+func knownTxs(ctx context.Context, backend txBackend, record TxRecord) ([]*types.Transaction, error) {
+	var known []*types.Transaction
+	for _, hash := range append(append([]string{}, record.Replaced...), record.Hash) {
+		tx, _, err := backend.TransactionByHash(ctx, common.HexToHash(hash))
+		if errors.Is(err, ethereum.NotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		known = append(known, tx)
+	}
+	return known, nil
+}
+
+// Wait until one of the transactions sent with the same nonce is mined and has the number of confirmations.
+// Record gets the hash of the mined transaction. Reverted transaction returns *RevertError
+func confirm(ctx context.Context, backend txBackend, from common.Address, txs []*types.Transaction, record TxRecord, confirmations uint64) (TxRecord, error) {
+	if confirmations == 0 {
+		confirmations = 1
+	}
+	ticker := time.NewTicker(receiptPollInterval)
+	defer ticker.Stop()
+	wait := func() error {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %s", ErrConfirmTimeout, record.Hash)
+		case <-ticker.C:
+			return nil
+		}
+	}
+
+	var (
+		tx      *types.Transaction
+		receipt *types.Receipt
+	)
+	for receipt == nil {
+		for _, sent := range txs {
+			r, err := backend.TransactionReceipt(ctx, sent.Hash())
+			if err == nil {
+				tx, receipt = sent, r
+				break
+			}
+			if !errors.Is(err, ethereum.NotFound) && ctx.Err() == nil {
+				return record, err
+			}
+		}
+		if receipt != nil {
+			break
+		}
+		if err := wait(); err != nil {
+			return record, err
+		}
+	}
+	record.Hash = tx.Hash().Hex()
+	record.BlockNumber = receipt.BlockNumber.Uint64()
+	record.GasUsed = receipt.GasUsed
+	if receipt.Status == types.ReceiptStatusFailed {
+		record.Status = TxReverted
+		return record, &RevertError{Tx: record, Reason: revertReason(ctx, backend, from, tx, receipt.BlockNumber)}
+	}
+
+	for {
+		head, err := backend.HeaderByNumber(ctx, nil)
+		if err != nil && ctx.Err() == nil {
+			return record, err
+		}
+		if err == nil && head.Number.Uint64() >= record.BlockNumber {
+			record.Confirmations = head.Number.Uint64() - record.BlockNumber + 1
+			if record.Confirmations >= confirmations {
+				record.Status = TxConfirmed
+				return record, nil
+			}
+		}
+		if err := wait(); err != nil {
+			return record, err
+		}
+	}
+}
+
+// Replay reverted transaction to get the revert reason
+func revertReason(ctx context.Context, backend txBackend, from common.Address, tx *types.Transaction, block *big.Int) string {
+	_, err := backend.CallContract(ctx, ethereum.CallMsg{
+		From:  from,
+		To:    tx.To(),
+		Gas:   tx.Gas(),
+		Value: tx.Value(),
+		Data:  tx.Data(),
+	}, block)
+	if err != nil {
+		return err.Error()
+	}
+	return "unknown reason"
+}
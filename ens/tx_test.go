@@ -0,0 +1,90 @@
+package ens
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Contract that reverts every call
+var revertingContract = hexutil.MustDecode("0x6005600c60003960056000f360006000fd")
+
+func TestConfirm(t *testing.T) {
+	pollInterval := receiptPollInterval
+	receiptPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { receiptPollInterval = pollInterval })
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{from: {Balance: big.NewInt(1e18)}}, 10_000_000)
+	defer backend.Close()
+	opts, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	send := func(nonce uint64, to *common.Address, data []byte) *types.Transaction {
+		tx := types.NewTx(&types.LegacyTx{Nonce: nonce, To: to, Gas: 100000, GasPrice: big.NewInt(1e10), Data: data})
+		signed, err := opts.Signer(from, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := backend.SendTransaction(ctx, signed); err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	// Deploy and wait for two confirmations
+	deploy := send(0, nil, revertingContract)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2; i++ {
+			time.Sleep(50 * time.Millisecond)
+			backend.Commit()
+		}
+	}()
+	record, err := confirm(ctx, backend, from, []*types.Transaction{deploy}, newTxRecord(deploy, "deploy"), 2)
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != TxConfirmed || record.Confirmations != 2 || record.BlockNumber != 1 || record.GasUsed == 0 {
+		t.Fatalf("Unexpected record %+v", record)
+	}
+
+	receipt, err := backend.TransactionReceipt(ctx, deploy.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := send(1, &receipt.ContractAddress, nil)
+	backend.Commit()
+	record, err = confirm(ctx, backend, from, []*types.Transaction{call}, newTxRecord(call, ActionSetText), 1)
+	var revert *RevertError
+	if !errors.As(err, &revert) {
+		t.Fatalf("Expected RevertError, got %v", err)
+	}
+	if record.Status != TxReverted || revert.Tx.Hash != call.Hash().Hex() {
+		t.Fatalf("Unexpected record %+v", record)
+	}
+
+	// Never mined transaction
+	pending := types.NewTx(&types.LegacyTx{Nonce: 5, Gas: 21000, GasPrice: big.NewInt(1)})
+	timeout, cancelTimeout := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelTimeout()
+	if _, err := confirm(timeout, backend, from, []*types.Transaction{pending}, newTxRecord(pending, ActionSetText), 1); !errors.Is(err, ErrConfirmTimeout) {
+		t.Fatalf("Expected ErrConfirmTimeout, got %v", err)
+	}
+}
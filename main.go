@@ -2,22 +2,83 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/big"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
+	"github.com/torvald2/hack-fs-2023-promise-card/ens"
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+	"github.com/torvald2/hack-fs-2023-promise-card/ratelimit"
 	"github.com/torvald2/hack-fs-2023-promise-card/router"
+	"github.com/torvald2/hack-fs-2023-promise-card/timelock"
+	"github.com/torvald2/hack-fs-2023-promise-card/usecases"
 	"go.uber.org/zap"
 )
 
+// Number of service signing keys published after rotation
+const retainedKeys = 3
+
 func main() {
 	InitLogger("DEBUG")
 
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		os.Exit(runAPIKeyCommand(GetConfig(), os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "polybase" {
+		os.Exit(runPolybaseCommand(GetConfig(), os.Args[2:]))
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	conf := GetConfig()
-	r := router.NewRouter(conf.PolybaseKey, conf.PolybaseUrl, conf.PolybaseCollection, conf.TimelockHost, conf.TimelockHash, conf.PinataKey, conf.ENSOwnerAdress, conf.ENSOwnerPrivateKey, conf.EnsMainDomain, conf.RpcUrl, conf.EnsResolverAddress)
+	store, err := newRecordStore(conf)
+	if err != nil {
+		Logger.Panic("Record store initialization error", zap.Error(err))
+	}
+	network, err := newTimelockNetwork(conf)
+	if err != nil {
+		Logger.Panic("Timelock network initialization error", zap.Error(err))
+	}
+	issuer, err := newIssuer(conf, ctx.Done())
+	if err != nil {
+		Logger.Panic("Token issuer initialization error", zap.Error(err))
+	}
+	sessions, err := newSessions(conf, store, issuer)
+	if err != nil {
+		Logger.Panic("Sessions initialization error", zap.Error(err))
+	}
+	grantAdmins(conf, store)
+	// Expired authorization codes and sessions are deleted hourly
+	usecases.AutoCollectExpired(store, time.Hour, ctx.Done(), func(err error) {
+		Logger.Error("Expired records collection error", zap.Error(err))
+	})
+	protection, err := newProtection(conf)
+	if err != nil {
+		Logger.Panic("Abuse protection initialization error", zap.Error(err))
+	}
+	ensConfig, err := newENSConfig(conf)
+	if err != nil {
+		Logger.Panic("ENS configuration error", zap.Error(err))
+	}
+	chainID, err := siweChainID(conf)
+	if err != nil {
+		Logger.Panic("Sign-in configuration error", zap.Error(err))
+	}
+	ensService := ens.NewENSAdaptor(ensConfig)
+	r, stopJobs := router.NewRouter(store, network, sessions, protection, conf.PinataKey, ensService, conf.SIWEDomain, chainID, conf.OIDCLoginURL, conf.APIKeysRequired != "false")
+	// Client addresses of rate limits are taken from X-Forwarded-For only behind trusted proxies
+	if err := r.SetTrustedProxies(trustedProxies(conf)); err != nil {
+		Logger.Panic("Trusted proxies configuration error", zap.Error(err))
+	}
 	srv := &http.Server{
 		Addr:    conf.TCPPort,
 		Handler: r,
@@ -25,7 +86,7 @@ func main() {
 
 	go func() {
 		Logger.Info(fmt.Sprintf("Listen started on port %s", conf.TCPPort))
-		if err := srv.ListenAndServe(); err != nil {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			Logger.Panic("Handle server error", zap.Error(err))
 		}
 	}()
@@ -35,9 +96,273 @@ func main() {
 	signal.Notify(c, os.Interrupt)
 	<-c
 	Logger.Info("App Interrputtes. Waiting for graseful shutdown")
-	srv.Shutdown(ctx)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 30*time.Second)
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		Logger.Error("Http server shutdown error", zap.Error(err))
+	}
+	cancelShutdown()
 	Logger.Info("Http server stopped")
+	// Running provisioning jobs finish their ENS writes before the service is closed.
+	// Jobs still running after the timeout are resumed on start without sending their transactions again
+	stopCtx, cancelStop := context.WithTimeout(context.Background(), 30*time.Second)
+	if err := stopJobs(stopCtx); err != nil {
+		Logger.Warn("Provisioning jobs are interrupted", zap.Error(err))
+	} else {
+		Logger.Info("Provisioning jobs stopped")
+	}
+	cancelStop()
+	ensService.Close()
 	cancel()
 	os.Exit(0)
 
 }
+
+// Create drand network selected by TIMELOCK_NETWORK
+func newTimelockNetwork(conf *AppConfig) (timelock.Network, error) {
+	switch conf.TimelockNetwork {
+	case "", "http":
+		return timelock.NewHTTPNetwork(conf.TimelockHost, conf.TimelockHash)
+	case "local":
+		// Keys sealed to a random key or to rounds of another genesis can't be opened after restart
+		if conf.TimelockLocalSeed == "" || conf.TimelockLocalGenesis == "" {
+			return nil, errors.New("TIMELOCK_LOCAL_SEED and TIMELOCK_LOCAL_GENESIS are required by the local timelock network")
+		}
+		seed := []byte(conf.TimelockLocalSeed)
+		sec, err := strconv.ParseInt(conf.TimelockLocalGenesis, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		genesis := time.Unix(sec, 0)
+		period := 3 * time.Second
+		if conf.TimelockLocalPeriod != "" {
+			if period, err = time.ParseDuration(conf.TimelockLocalPeriod); err != nil {
+				return nil, err
+			}
+		}
+		return timelock.NewLocalNetwork(seed, genesis, period)
+	default:
+		return nil, fmt.Errorf("Unknown timelock network %s", conf.TimelockNetwork)
+	}
+}
+
+// Create token issuer with the service keyring rotated every JWT_KEY_ROTATION.
+// OpenID Connect relying parties discover the provider at the issuer, so it must be an https url when OIDC is enabled
+func newIssuer(conf *AppConfig, done <-chan struct{}) (*auth.Issuer, error) {
+	name := conf.JWTIssuer
+	if name == "" {
+		name = "promisecards"
+	}
+	if conf.OIDCLoginURL != "" {
+		if u, err := url.Parse(name); err != nil || u.Scheme != "https" || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("JWT_ISSUER must be an https url without query and fragment when OIDC_LOGIN_URL is set, got %q", name)
+		}
+	}
+	keyring, err := auth.NewKeyring(conf.JWTKeysDir, conf.JWTKeyAlg, retainedKeys)
+	if err != nil {
+		return nil, err
+	}
+	if conf.JWTKeyRotation != "" {
+		period, err := time.ParseDuration(conf.JWTKeyRotation)
+		if err != nil {
+			return nil, err
+		}
+		keyring.AutoRotate(period, done, func(err error) {
+			Logger.Error("Signing key rotation error", zap.Error(err))
+		})
+	}
+	return auth.NewIssuer(name, conf.JWTSigning, keyring)
+}
+
+// Create sessions with ACCESS_TOKEN_TTL and REFRESH_TOKEN_TTL
+func newSessions(conf *AppConfig, store polybase.RecordStore, issuer *auth.Issuer) (*usecases.SessionUseCase, error) {
+	accessTTL, refreshTTL := 10*time.Minute, 30*24*time.Hour
+	var err error
+	if conf.AccessTokenTTL != "" {
+		if accessTTL, err = time.ParseDuration(conf.AccessTokenTTL); err != nil {
+			return nil, err
+		}
+	}
+	if conf.RefreshTokenTTL != "" {
+		if refreshTTL, err = time.ParseDuration(conf.RefreshTokenTTL); err != nil {
+			return nil, err
+		}
+	}
+	return usecases.NewSessionUseCase(store, issuer, accessTTL, refreshTTL), nil
+}
+
+// ENS service settings with confirmation, resubmit and fee settings
+func newENSConfig(conf *AppConfig) (ensConfig ens.Config, err error) {
+	ensConfig = ens.Config{
+		OwnerAddress:    conf.ENSOwnerAdress,
+		PrivateKey:      conf.ENSOwnerPrivateKey,
+		MainDomain:      conf.EnsMainDomain,
+		RPCUrl:          conf.RpcUrl,
+		ResolverAddress: conf.EnsResolverAddress,
+		ReverseRecords:  conf.ENSReverseRecords == "true",
+		KeepCustody:     conf.ENSKeepCustody == "true",
+	}
+	if conf.ENSConfirmations != "" {
+		if ensConfig.Confirmations, err = strconv.ParseUint(conf.ENSConfirmations, 10, 64); err != nil {
+			return
+		}
+	}
+	if conf.ENSConfirmTimeout != "" {
+		if ensConfig.ConfirmTimeout, err = time.ParseDuration(conf.ENSConfirmTimeout); err != nil {
+			return
+		}
+	}
+	if conf.ENSResubmitAfter != "" {
+		if ensConfig.ResubmitAfter, err = time.ParseDuration(conf.ENSResubmitAfter); err != nil {
+			return
+		}
+	}
+	if conf.ENSMaxFeeGwei != "" {
+		if ensConfig.MaxGasFeeCap, err = parseGwei(conf.ENSMaxFeeGwei); err != nil {
+			return
+		}
+	}
+	if conf.ENSMaxTipGwei != "" {
+		if ensConfig.MaxGasTipCap, err = parseGwei(conf.ENSMaxTipGwei); err != nil {
+			return
+		}
+	}
+	if conf.ENSGasMargin != "" {
+		if ensConfig.GasMargin, err = strconv.ParseFloat(conf.ENSGasMargin, 64); err != nil {
+			return
+		}
+		if ensConfig.GasMargin < 1 {
+			return ensConfig, fmt.Errorf("ENS_GAS_MARGIN must be at least 1, got %v", ensConfig.GasMargin)
+		}
+	}
+	return
+}
+
+// Decimal gwei amount in wei
+func parseGwei(value string) (*big.Int, error) {
+	gwei, ok := new(big.Float).SetString(value)
+	if !ok || gwei.Sign() < 0 {
+		return nil, fmt.Errorf("Bad gwei amount %q", value)
+	}
+	wei, _ := gwei.Mul(gwei, big.NewFloat(params.GWei)).Int(nil)
+	return wei, nil
+}
+
+// Create rate limits and challenge of POST /users and rate limits of text records updates and nick lookups
+func newProtection(conf *AppConfig) (protection ratelimit.Protection, err error) {
+	var rules []ratelimit.Rule
+	for _, l := range []struct {
+		value string
+		rule  func(ratelimit.Limit) ratelimit.Rule
+	}{
+		{conf.RateLimitIP, ratelimit.PerIP},
+		{conf.RateLimitAPIKey, ratelimit.PerAPIKey},
+		{conf.RateLimitGlobal, ratelimit.Global},
+	} {
+		limit, ok, err := ratelimit.ParseLimit(l.value)
+		if err != nil {
+			return protection, err
+		}
+		if ok {
+			rules = append(rules, l.rule(limit))
+		}
+	}
+	var backend ratelimit.Backend
+	switch conf.RateLimitBackend {
+	case "", "memory":
+		backend = ratelimit.NewMemoryBackend()
+	default:
+		return protection, fmt.Errorf("Unknown rate limit backend %s", conf.RateLimitBackend)
+	}
+	if len(rules) > 0 {
+		protection.Limiter = ratelimit.NewLimiter(backend, rules...)
+	}
+	recordsLimit := conf.RateLimitRecords
+	if recordsLimit == "" {
+		recordsLimit = "10/h"
+	}
+	limit, _, err := ratelimit.ParseLimit(recordsLimit)
+	if err != nil {
+		return protection, err
+	}
+	protection.Records = ratelimit.NewLimiter(backend, ratelimit.PerSubject(limit))
+	lookupsLimit := conf.RateLimitLookups
+	if lookupsLimit == "" {
+		lookupsLimit = "60/m"
+	}
+	if limit, _, err = ratelimit.ParseLimit(lookupsLimit); err != nil {
+		return protection, err
+	}
+	protection.Lookups = ratelimit.NewLimiter(backend, ratelimit.PerIP(limit))
+	noncesLimit := conf.RateLimitNonces
+	if noncesLimit == "" {
+		noncesLimit = "30/m"
+	}
+	if limit, _, err = ratelimit.ParseLimit(noncesLimit); err != nil {
+		return protection, err
+	}
+	protection.Nonces = ratelimit.NewLimiter(backend, ratelimit.PerIP(limit))
+	if conf.PoWDifficulty != "" && conf.CaptchaVerifyURL != "" {
+		return protection, fmt.Errorf("POW_DIFFICULTY and CAPTCHA_VERIFY_URL can't be used together")
+	}
+	if conf.PoWDifficulty != "" {
+		difficulty, err := strconv.Atoi(conf.PoWDifficulty)
+		if err != nil {
+			return protection, err
+		}
+		if protection.Challenge, err = ratelimit.NewProofOfWork(difficulty, 10*time.Minute); err != nil {
+			return protection, err
+		}
+	}
+	if conf.CaptchaVerifyURL != "" {
+		protection.Challenge = ratelimit.NewCaptchaVerifier(conf.CaptchaVerifyURL, conf.CaptchaSecret)
+	}
+	return protection, nil
+}
+
+// SIWE_CHAIN_ID, mainnet if empty
+func siweChainID(conf *AppConfig) (int64, error) {
+	if conf.SIWEChainID == "" {
+		return 1, nil
+	}
+	return strconv.ParseInt(conf.SIWEChainID, 10, 64)
+}
+
+// TRUSTED_PROXIES addresses and networks, nil trusts no proxy
+func trustedProxies(conf *AppConfig) []string {
+	var proxies []string
+	for _, proxy := range strings.Split(conf.TrustedProxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// Grant admin role to ADMIN_ADDRESSES users
+func grantAdmins(conf *AppConfig, store polybase.RecordStore) {
+	for _, address := range strings.Split(conf.AdminAddresses, ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+		if _, err := usecases.GrantRole(store, address, auth.RoleAdmin); err != nil {
+			Logger.Warn("Grant admin role error", zap.String("address", address), zap.Error(err))
+		}
+	}
+}
+
+// Create record store selected by STORAGE_BACKEND
+func newRecordStore(conf *AppConfig) (polybase.RecordStore, error) {
+	switch conf.StorageBackend {
+	case "", "polybase":
+		return polybase.NewPolybaseStore(conf.PolybaseCollection, conf.PolybaseUrl, conf.PolybaseKey)
+	case "bolt":
+		path := conf.StoragePath
+		if path == "" {
+			path = "promisecard.db"
+		}
+		return polybase.NewBoltStore(path)
+	default:
+		return nil, fmt.Errorf("Unknown storage backend %s", conf.StorageBackend)
+	}
+}
@@ -77,6 +77,57 @@ func (p PinanaAPI) PinImage(data []byte, imageName string) (cid string, err erro
 	cid = hashResp.IpfsHash
 	return
 }
+func (p PinanaAPI) Unpin(cid string) error {
+	url := fmt.Sprintf("https://api.pinata.cloud/pinning/unpin/%s", cid)
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Bad status. StatusCode = %v Data %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// Check that the cid is pinned by our account
+func (p PinanaAPI) IsPinned(cid string) (bool, error) {
+	url := fmt.Sprintf("https://api.pinata.cloud/data/pinList?status=pinned&hashContains=%s", cid)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode != 200 {
+		return false, fmt.Errorf("Bad status. StatusCode = %v Data %s", resp.StatusCode, string(body))
+	}
+	list := struct {
+		Count int `json:"count"`
+	}{}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return false, err
+	}
+	return list.Count > 0, nil
+}
+
 func New(token string) *PinanaAPI {
 	tripper := AddHeaderTransport{T: http.DefaultTransport, AccessToken: token}
 	client := &http.Client{
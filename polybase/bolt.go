@@ -0,0 +1,189 @@
+package polybase
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var ErrStoreInUse = errors.New("store is used by another process")
+
+// Time to wait for the file lock held by another process, e.g. the server while the apikey command runs
+const boltOpenTimeout = time.Second
+
+// Embedded RecordStore backend for offline development and CI.
+// Every collection is a bucket, records are json encoded values.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("%w: %s", ErrStoreInUse, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) Create(collection, id string, fields map[string]interface{}) (map[string]interface{}, error) {
+	record := copyFields(fields)
+	record["id"] = id
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(collection))
+		if err != nil {
+			return err
+		}
+		if b.Get([]byte(id)) != nil {
+			return ErrAlreadyExists
+		}
+		return put(b, id, record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(collection, id)
+}
+
+func (s *BoltStore) Get(collection, id string) (record map[string]interface{}, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(collection))
+		if b == nil {
+			return ErrNotFound
+		}
+		record, err = get(b, id)
+		return err
+	})
+	return
+}
+
+func (s *BoltStore) List(collection, cursor string, limit int) (records []map[string]interface{}, next string, err error) {
+	records = make([]map[string]interface{}, 0)
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(collection))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		k, v := c.First()
+		if cursor != "" {
+			k, v = c.Seek([]byte(cursor))
+			if k != nil && string(k) == cursor {
+				k, v = c.Next()
+			}
+		}
+		for ; k != nil; k, v = c.Next() {
+			if limit > 0 && len(records) == limit {
+				next = records[len(records)-1]["id"].(string)
+				break
+			}
+			record := make(map[string]interface{})
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	return
+}
+
+func (s *BoltStore) Update(collection, id string, fields map[string]interface{}) (record map[string]interface{}, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(collection))
+		if b == nil {
+			return ErrNotFound
+		}
+		record, err = get(b, id)
+		if err != nil {
+			return err
+		}
+		// Numbers are decoded from json as float64
+		version, _ := record["version"].(float64)
+		for k, v := range fields {
+			record[k] = v
+		}
+		record["id"] = id
+		record["version"] = int(version) + 1
+		if err := put(b, id, record); err != nil {
+			return err
+		}
+		record, err = get(b, id)
+		return err
+	})
+	return
+}
+
+func (s *BoltStore) UpdateVersion(collection, id string, version int, fields map[string]interface{}) (record map[string]interface{}, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(collection))
+		if b == nil {
+			return ErrNotFound
+		}
+		record, err = get(b, id)
+		if err != nil {
+			return err
+		}
+		// Numbers are decoded from json as float64
+		current, _ := record["version"].(float64)
+		if int(current) != version {
+			return fmt.Errorf("%w: %s/%s", ErrVersionConflict, collection, id)
+		}
+		for k, v := range fields {
+			record[k] = v
+		}
+		record["id"] = id
+		record["version"] = version + 1
+		if err := put(b, id, record); err != nil {
+			return err
+		}
+		record, err = get(b, id)
+		return err
+	})
+	return
+}
+
+func (s *BoltStore) Delete(collection, id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(collection))
+		if b == nil || b.Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+		return b.Delete([]byte(id))
+	})
+}
+
+func get(b *bolt.Bucket, id string) (map[string]interface{}, error) {
+	data := b.Get([]byte(id))
+	if data == nil {
+		return nil, ErrNotFound
+	}
+	record := make(map[string]interface{})
+	err := json.Unmarshal(data, &record)
+	return record, err
+}
+
+func put(b *bolt.Bucket, id string, record map[string]interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(id), data)
+}
+
+func copyFields(fields map[string]interface{}) map[string]interface{} {
+	record := make(map[string]interface{}, len(fields)+1)
+	for k, v := range fields {
+		record[k] = v
+	}
+	return record
+}
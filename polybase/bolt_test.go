@@ -0,0 +1,76 @@
+package polybase
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestBoltStore(t *testing.T) {
+	store, err := NewBoltStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	for _, id := range []string{"1", "2", "3"} {
+		if _, err := store.Create("User", id, map[string]interface{}{"nick": "nick" + id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.Create("User", "1", nil); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Expected ErrAlreadyExists, got %v", err)
+	}
+
+	rec, err := store.Update("User", "2", map[string]interface{}{"avatar": "ipfs://cid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec["nick"] != "nick2" || rec["avatar"] != "ipfs://cid" || rec["id"] != "2" {
+		t.Errorf("Bad updated record %v", rec)
+	}
+
+	page, next, err := store.List("User", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || next != "2" {
+		t.Fatalf("Bad first page %v next %s", page, next)
+	}
+	page, next, err = store.List("User", next, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0]["id"] != "3" || next != "" {
+		t.Fatalf("Bad second page %v next %s", page, next)
+	}
+
+	if _, err := store.UpdateVersion("User", "3", 0, map[string]interface{}{"nick": "nick3b"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.UpdateVersion("User", "3", 0, map[string]interface{}{"nick": "nick3c"}); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+	if rec, _ := store.Get("User", "3"); rec["nick"] != "nick3b" || rec["version"] != float64(1) {
+		t.Errorf("Bad versioned record %v", rec)
+	}
+
+	if err := store.Delete("User", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("User", "1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestBoltStoreInUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	store, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, err := NewBoltStore(path); !errors.Is(err, ErrStoreInUse) {
+		t.Fatalf("Expected ErrStoreInUse, got %v", err)
+	}
+}
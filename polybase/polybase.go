@@ -15,6 +15,8 @@ import (
 type PolybaseClient struct {
 	namespace string
 	url       string
+	key       string
+	client    *http.Client
 }
 
 func (c *PolybaseClient) createAuthHeader(body []byte, key string) (header string, err error) {
@@ -119,5 +121,16 @@ func NewPolybaseClient(namespace, url string) (*PolybaseClient, error) {
 	return &PolybaseClient{
 		namespace: namespace,
 		url:       url,
+		client:    &http.Client{},
 	}, nil
 }
+
+// Create polybase client that signs RecordStore requests with the key
+func NewPolybaseStore(namespace, url, key string) (*PolybaseClient, error) {
+	cl, err := NewPolybaseClient(namespace, url)
+	if err != nil {
+		return nil, err
+	}
+	cl.key = key
+	return cl, nil
+}
@@ -0,0 +1,277 @@
+package polybase
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	ErrNotFound        = errors.New("record not found")
+	ErrAlreadyExists   = errors.New("record already exists")
+	ErrVersionConflict = errors.New("record version conflict")
+)
+
+// RecordStore stores json records grouped by collections.
+// Every record is identified by id that is unique inside the collection
+// and always returned in the "id" field of the record.
+type RecordStore interface {
+	Create(collection, id string, fields map[string]interface{}) (map[string]interface{}, error)
+	Get(collection, id string) (map[string]interface{}, error)
+	// List returns up to limit records after the cursor and the cursor of the next page.
+	// Empty next cursor means that there are no more records.
+	List(collection, cursor string, limit int) (records []map[string]interface{}, next string, err error)
+	// Update merges fields into the stored record and increments its version.
+	// Fields written concurrently by other updates are kept
+	Update(collection, id string, fields map[string]interface{}) (map[string]interface{}, error)
+	// UpdateVersion merges fields into the stored record when its "version" field equals the version
+	// and increments the version. ErrVersionConflict when the record was updated by someone else
+	UpdateVersion(collection, id string, version int, fields map[string]interface{}) (map[string]interface{}, error)
+	Delete(collection, id string) error
+}
+
+// Every collection used as RecordStore must follow the schema returned by Schema.
+// Records are readable and writable only with the service key, the constructor
+// refuses other keys and the owner of the record is checked by every other function.
+//
+// Record fields are kept json encoded in the data field, the version is kept in its own field.
+// Records of the first (id, nick) User schema have only the nick field, they are read
+// as records with the nick and zero version, so they can be copied to a namespace with this schema
+const schema = `collection %s {
+  id: string;
+  data: string;
+  version: number;
+  @read
+  owner: PublicKey;
+  constructor (id: string, data: string) {
+    if (ctx.publicKey.toHex() != '%s') { error('not the service key'); }
+    this.id = id; this.data = data; this.version = 0; this.owner = ctx.publicKey;
+  }
+  updateVersion (data: string, version: number) {
+    if (ctx.publicKey != this.owner) { error('not the service key'); }
+    if (this.version != version) { error('version conflict'); }
+    this.data = data; this.version = version + 1;
+  }
+  del () {
+    if (ctx.publicKey != this.owner) { error('not the service key'); }
+    selfdestruct();
+  }
+}
+`
+
+// Polybase schema of the collection restricted to the service key
+func Schema(collection, key string) (string, error) {
+	privateKey, err := crypto.HexToECDSA(key)
+	if err != nil {
+		return "", err
+	}
+	publicKey := hexutil.Encode(crypto.FromECDSAPub(&privateKey.PublicKey)[1:])
+	return fmt.Sprintf(schema, collection, publicKey), nil
+}
+
+type polybaseRecord struct {
+	Data struct {
+		ID      string `json:"id"`
+		Data    string `json:"data"`
+		Version int    `json:"version"`
+		Nick    string `json:"nick"` // first User schema
+	} `json:"data"`
+}
+
+type polybaseList struct {
+	Data   []polybaseRecord `json:"data"`
+	Cursor struct {
+		After string `json:"after"`
+	} `json:"cursor"`
+}
+
+func (r polybaseRecord) fields() (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	if r.Data.Data != "" {
+		if err := json.Unmarshal([]byte(r.Data.Data), &fields); err != nil {
+			return nil, err
+		}
+	}
+	if r.Data.Data == "" && r.Data.Nick != "" {
+		fields["nick"] = r.Data.Nick
+	}
+	fields["id"] = r.Data.ID
+	fields["version"] = r.Data.Version
+	return fields, nil
+}
+
+func (c *PolybaseClient) Create(collection, id string, fields map[string]interface{}) (map[string]interface{}, error) {
+	data, err := encodeFields(fields)
+	if err != nil {
+		return nil, err
+	}
+	var rec polybaseRecord
+	if err := c.call("POST", c.recordsUrl(collection), []interface{}{id, data}, &rec); err != nil {
+		return nil, err
+	}
+	return rec.fields()
+}
+
+func (c *PolybaseClient) Get(collection, id string) (map[string]interface{}, error) {
+	var rec polybaseRecord
+	if err := c.call("GET", fmt.Sprintf("%s/%s", c.recordsUrl(collection), url.PathEscape(id)), nil, &rec); err != nil {
+		return nil, err
+	}
+	return rec.fields()
+}
+
+func (c *PolybaseClient) List(collection, cursor string, limit int) ([]map[string]interface{}, string, error) {
+	query := url.Values{}
+	if cursor != "" {
+		query.Set("after", cursor)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var list polybaseList
+	if err := c.call("GET", fmt.Sprintf("%s?%s", c.recordsUrl(collection), query.Encode()), nil, &list); err != nil {
+		return nil, "", err
+	}
+	records := make([]map[string]interface{}, 0, len(list.Data))
+	for _, rec := range list.Data {
+		fields, err := rec.fields()
+		if err != nil {
+			return nil, "", err
+		}
+		records = append(records, fields)
+	}
+	next := list.Cursor.After
+	if limit <= 0 || len(records) < limit {
+		next = ""
+	}
+	return records, next, nil
+}
+
+// Attempts of Update when the record is changed concurrently
+const updateAttempts = 5
+
+// Update merges fields into the current record with the compare-and-set of its version,
+// so fields written concurrently are not overwritten with the stale values
+func (c *PolybaseClient) Update(collection, id string, fields map[string]interface{}) (map[string]interface{}, error) {
+	var err error
+	for i := 0; i < updateAttempts; i++ {
+		var current, rec map[string]interface{}
+		current, err = c.Get(collection, id)
+		if err != nil {
+			return nil, err
+		}
+		version, _ := current["version"].(int)
+		rec, err = c.updateVersion(collection, id, version, current, fields)
+		if !errors.Is(err, ErrVersionConflict) {
+			return rec, err
+		}
+	}
+	return nil, err
+}
+
+func (c *PolybaseClient) UpdateVersion(collection, id string, version int, fields map[string]interface{}) (map[string]interface{}, error) {
+	current, err := c.Get(collection, id)
+	if err != nil {
+		return nil, err
+	}
+	return c.updateVersion(collection, id, version, current, fields)
+}
+
+func (c *PolybaseClient) updateVersion(collection, id string, version int, current, fields map[string]interface{}) (map[string]interface{}, error) {
+	for k, v := range fields {
+		current[k] = v
+	}
+	data, err := encodeFields(current)
+	if err != nil {
+		return nil, err
+	}
+	var rec polybaseRecord
+	err = c.call("POST", c.functionUrl(collection, id, "updateVersion"), []interface{}{data, version}, &rec)
+	if err != nil && strings.Contains(err.Error(), "version conflict") {
+		return nil, fmt.Errorf("%w: %s/%s", ErrVersionConflict, collection, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rec.fields()
+}
+
+func (c *PolybaseClient) Delete(collection, id string) error {
+	return c.call("POST", c.functionUrl(collection, id, "del"), []interface{}{}, nil)
+}
+
+func (c *PolybaseClient) recordsUrl(collection string) string {
+	path := url.QueryEscape(fmt.Sprintf("%s/%s", c.namespace, collection))
+	return fmt.Sprintf("%s/v0/collections/%s/records", c.url, path)
+}
+
+func (c *PolybaseClient) functionUrl(collection, id, function string) string {
+	return fmt.Sprintf("%s/%s/call/%s", c.recordsUrl(collection), url.PathEscape(id), function)
+}
+
+// Make signed request to the polybase api.
+// Nil args means request without body
+func (c *PolybaseClient) call(method, url string, args []interface{}, result interface{}) error {
+	body := []byte("{}")
+	var reqBody io.Reader
+	if args != nil {
+		body, _ = json.Marshal(map[string]interface{}{
+			"args": args,
+		})
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		return err
+	}
+	header, err := c.createAuthHeader(body, c.key)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("X-Polybase-Signature", header)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode == http.StatusConflict {
+		return fmt.Errorf("%w: %s", ErrAlreadyExists, string(respBody))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Bad status. StatusCode = %v Data %s", resp.StatusCode, string(respBody))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, result)
+}
+
+func encodeFields(fields map[string]interface{}) (string, error) {
+	data := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if k == "id" || k == "version" {
+			continue
+		}
+		data[k] = v
+	}
+	encoded, err := json.Marshal(data)
+	return string(encoded), err
+}
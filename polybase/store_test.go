@@ -0,0 +1,34 @@
+package polybase
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLegacyRecordFields(t *testing.T) {
+	var rec polybaseRecord
+	if err := json.Unmarshal([]byte(`{"data":{"id":"0xabc","nick":"alice"}}`), &rec); err != nil {
+		t.Fatal(err)
+	}
+	fields, err := rec.fields()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields["id"] != "0xabc" || fields["nick"] != "alice" || fields["version"] != 0 {
+		t.Errorf("Bad legacy record fields %v", fields)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	schema, err := Schema("User", "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(schema, "collection User {") || strings.Count(schema, "not the service key") != 3 {
+		t.Errorf("Bad schema %s", schema)
+	}
+	if _, err := Schema("User", "bad key"); err == nil {
+		t.Error("Expected bad key error")
+	}
+}
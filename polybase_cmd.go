@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+	"github.com/torvald2/hack-fs-2023-promise-card/usecases"
+)
+
+const polybaseUsage = `Usage:
+  polybase schema                      schemas of the collections restricted to POLYBASE_KEY
+  polybase migrate <legacy namespace>  copy users of the (id, nick) schema to POLYBASE_COLLECTION`
+
+// Collections deployed to the polybase namespace
+var polybaseCollections = []string{
+	usecases.UserCollection,
+	usecases.JobCollection,
+	usecases.ReconciliationCollection,
+	usecases.SessionCollection,
+	usecases.OAuthClientCollection,
+	usecases.AuthCodeCollection,
+	usecases.APIKeyCollection,
+	usecases.NickCollection,
+}
+
+// Polybase deployment helpers. Returns exit code
+func runPolybaseCommand(conf *AppConfig, args []string) int {
+	switch {
+	case len(args) == 1 && args[0] == "schema":
+		for _, collection := range polybaseCollections {
+			schema, err := polybase.Schema(collection, conf.PolybaseKey)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			fmt.Println(schema)
+		}
+	case len(args) == 2 && args[0] == "migrate":
+		legacy, err := polybase.NewPolybaseStore(args[1], conf.PolybaseUrl, conf.PolybaseKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		store, err := polybase.NewPolybaseStore(conf.PolybaseCollection, conf.PolybaseUrl, conf.PolybaseKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		copied, err := usecases.MigrateUsers(legacy, store)
+		fmt.Printf("copied %d users\n", copied)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	default:
+		fmt.Fprintln(os.Stderr, polybaseUsage)
+		return 2
+	}
+	return 0
+}
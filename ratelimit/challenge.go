@@ -0,0 +1,203 @@
+package ratelimit
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Challenge request headers
+const (
+	PoWChallengeHeader = "X-PoW-Challenge"
+	PoWSolutionHeader  = "X-PoW-Solution"
+	CaptchaHeader      = "X-Captcha-Token"
+)
+
+var (
+	ErrChallengeRequired = errors.New("challenge required")
+	ErrChallengeFailed   = errors.New("challenge failed")
+)
+
+// Hook that checks the caller is not a script: proof of work, captcha etc
+type Challenge interface {
+	Verify(c *gin.Context) error
+}
+
+// Gin middleware that responds 403 when challenge is not passed
+func RequireChallenge(challenge Challenge) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := challenge.Verify(c); err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Hashcash like proof of work.
+// Client gets signed challenge and finds solution so that sha256(challenge:solution)
+// starts with Difficulty zero bits. Every challenge is accepted once
+type ProofOfWork struct {
+	Difficulty int
+	ttl        time.Duration
+	secret     []byte
+	mu         sync.Mutex
+	used       map[string]time.Time
+}
+
+func NewProofOfWork(difficulty int, ttl time.Duration) (*ProofOfWork, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return &ProofOfWork{
+		Difficulty: difficulty,
+		ttl:        ttl,
+		secret:     secret,
+		used:       make(map[string]time.Time),
+	}, nil
+}
+
+func (p *ProofOfWork) sign(payload string) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *ProofOfWork) NewChallenge() (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	payload := fmt.Sprintf("%d.%s", time.Now().Unix(), hex.EncodeToString(random))
+	return fmt.Sprintf("%s.%s", payload, p.sign(payload)), nil
+}
+
+// Gin handler issuing new challenge
+func (p *ProofOfWork) IssueChallenge(c *gin.Context) {
+	challenge, err := p.NewChallenge()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{"challenge": challenge, "difficulty": p.Difficulty})
+}
+
+func (p *ProofOfWork) Verify(c *gin.Context) error {
+	return p.check(c.GetHeader(PoWChallengeHeader), c.GetHeader(PoWSolutionHeader))
+}
+
+func (p *ProofOfWork) check(challenge, solution string) error {
+	if challenge == "" || solution == "" {
+		return ErrChallengeRequired
+	}
+	dot := strings.LastIndex(challenge, ".")
+	if dot < 0 || !hmac.Equal([]byte(p.sign(challenge[:dot])), []byte(challenge[dot+1:])) {
+		return ErrChallengeFailed
+	}
+	issued, err := strconv.ParseInt(strings.SplitN(challenge, ".", 2)[0], 10, 64)
+	if err != nil || time.Since(time.Unix(issued, 0)) > p.ttl {
+		return ErrChallengeFailed
+	}
+	if leadingZeroBits(sha256.Sum256([]byte(challenge+":"+solution))) < p.Difficulty {
+		return ErrChallengeFailed
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for k, expires := range p.used {
+		if now.After(expires) {
+			delete(p.used, k)
+		}
+	}
+	if _, ok := p.used[challenge]; ok {
+		return ErrChallengeFailed
+	}
+	p.used[challenge] = time.Unix(issued, 0).Add(p.ttl)
+	return nil
+}
+
+func leadingZeroBits(hash [32]byte) int {
+	n := 0
+	for _, b := range hash {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// Captcha verifier for hCaptcha / reCAPTCHA compatible siteverify api
+type CaptchaVerifier struct {
+	URL    string
+	Secret string
+	client *http.Client
+}
+
+func NewCaptchaVerifier(url, secret string) *CaptchaVerifier {
+	return &CaptchaVerifier{URL: url, Secret: secret, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (v *CaptchaVerifier) Verify(c *gin.Context) error {
+	token := c.GetHeader(CaptchaHeader)
+	if token == "" {
+		return ErrChallengeRequired
+	}
+	resp, err := v.client.PostForm(v.URL, url.Values{
+		"secret":   {v.Secret},
+		"response": {token},
+		"remoteip": {c.ClientIP()},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Bad status. StatusCode = %v", resp.StatusCode)
+	}
+	result := struct {
+		Success bool `json:"success"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.Success {
+		return ErrChallengeFailed
+	}
+	return nil
+}
+
+// Abuse protection of costly endpoints. Nil fields disable protection
+type Protection struct {
+	Limiter   *Limiter // POST /users
+	Challenge Challenge
+	Records   *Limiter // PUT /users/:address/records, paid by the root owner
+	Lookups   *Limiter // GET /users/available, reads the chain
+	Nonces    *Limiter // GET /auth/nonce, nonces are kept in memory until they expire
+}
+
+func (p Protection) Handlers() []gin.HandlerFunc {
+	var handlers []gin.HandlerFunc
+	if p.Limiter != nil {
+		handlers = append(handlers, p.Limiter.Middleware())
+	}
+	if p.Challenge != nil {
+		handlers = append(handlers, RequireChallenge(p.Challenge))
+	}
+	return handlers
+}
@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
+	"go.uber.org/zap"
+)
+
+// Header with the caller API key
+const APIKeyHeader = "X-API-Key"
+
+// Gin context key of the authenticated API key id, set by the API key check
+const APIKeyIDKey = "apikey.id"
+
+// Token bucket limit: Rate tokens per second with Burst capacity
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Parse limit in N/unit form where unit is s, m, h or d, e.g. 10/h.
+// Burst equals N. Empty string means no limit
+func ParseLimit(s string) (limit Limit, ok bool, err error) {
+	if s == "" {
+		return limit, false, nil
+	}
+	count, unit, found := strings.Cut(s, "/")
+	n, err := strconv.Atoi(count)
+	if !found || err != nil || n <= 0 {
+		return limit, false, fmt.Errorf("Bad rate limit %s", s)
+	}
+	periods := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour, "d": 24 * time.Hour}
+	period, found := periods[unit]
+	if !found {
+		return limit, false, fmt.Errorf("Bad rate limit unit %s", s)
+	}
+	return Limit{Rate: float64(n) / period.Seconds(), Burst: n}, true, nil
+}
+
+// Storage of token buckets
+type Backend interface {
+	// Take one token from the bucket. Returns wait time until the next token when bucket is empty
+	Allow(key string, limit Limit) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// Rule limits requests with the same key. Requests with empty key are not limited by the rule
+type Rule struct {
+	Name  string
+	Limit Limit
+	Key   func(c *gin.Context) string
+}
+
+// Limit per client address. Forwarded addresses are used only from the engine trusted proxies
+func PerIP(limit Limit) Rule {
+	return Rule{Name: "ip", Limit: limit, Key: func(c *gin.Context) string { return c.ClientIP() }}
+}
+
+// Limit per authenticated API key, must be used after the API key check
+func PerAPIKey(limit Limit) Rule {
+	return Rule{Name: "api_key", Limit: limit, Key: func(c *gin.Context) string { return c.GetString(APIKeyIDKey) }}
+}
+
+// Limit per token subject, must be used after auth.Middleware
+func PerSubject(limit Limit) Rule {
+	return Rule{Name: "subject", Limit: limit, Key: func(c *gin.Context) string {
+		if claims, ok := auth.GetClaims(c); ok {
+			return claims.Subject
+		}
+		return ""
+	}}
+}
+
+func Global(limit Limit) Rule {
+	return Rule{Name: "global", Limit: limit, Key: func(c *gin.Context) string { return "*" }}
+}
+
+type Limiter struct {
+	backend Backend
+	rules   []Rule
+}
+
+func NewLimiter(backend Backend, rules ...Rule) *Limiter {
+	return &Limiter{backend: backend, rules: rules}
+}
+
+// Gin middleware that responds 429 with Retry-After when any rule is exceeded.
+// Backend errors don't block requests
+func (l *Limiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, rule := range l.rules {
+			key := rule.Key(c)
+			if key == "" {
+				continue
+			}
+			allowed, retryAfter, err := l.backend.Allow(fmt.Sprintf("%s:%s:%s", c.FullPath(), rule.Name, key), rule.Limit)
+			if err != nil {
+				zap.L().Error("Rate limit backend error", zap.String("rule", rule.Name), zap.Error(err))
+				continue
+			}
+			if !allowed {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, map[string]interface{}{"error": "rate limit exceeded", "limit": rule.Name})
+				return
+			}
+		}
+		c.Next()
+	}
+}
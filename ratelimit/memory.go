@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	refill  time.Duration // time to refill empty bucket
+}
+
+// In-memory backend. Limits are per process
+type MemoryBackend struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+	now     func() time.Time
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (m *MemoryBackend) Allow(key string, limit Limit) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.calls++
+	if m.calls%1000 == 0 {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{
+			tokens:  float64(limit.Burst),
+			updated: now,
+			refill:  time.Duration(float64(limit.Burst) / limit.Rate * float64(time.Second)),
+		}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second)), nil
+}
+
+// Remove buckets idle long enough to be refilled
+func (m *MemoryBackend) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if now.Sub(b.updated) > b.refill {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseLimit(t *testing.T) {
+	limit, ok, err := ParseLimit("10/h")
+	if err != nil || !ok {
+		t.Fatal(err)
+	}
+	if limit.Burst != 10 || limit.Rate != 10.0/3600 {
+		t.Fatalf("Unexpected limit %+v", limit)
+	}
+	if _, ok, _ := ParseLimit(""); ok {
+		t.Fatal("Empty limit must be disabled")
+	}
+	if _, _, err := ParseLimit("10/w"); err == nil {
+		t.Fatal("Expected error")
+	}
+}
+
+func TestMemoryBackend(t *testing.T) {
+	now := time.Now()
+	backend := NewMemoryBackend()
+	backend.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 2}
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := backend.Allow("a", limit); !ok {
+			t.Fatal("Expected allowed request")
+		}
+	}
+	ok, retryAfter, _ := backend.Allow("a", limit)
+	if ok || retryAfter != time.Second {
+		t.Fatalf("Expected limited request, retry after %v", retryAfter)
+	}
+	if ok, _, _ := backend.Allow("b", limit); !ok {
+		t.Fatal("Keys must have separate buckets")
+	}
+	now = now.Add(time.Second)
+	if ok, _, _ := backend.Allow("a", limit); !ok {
+		t.Fatal("Expected refilled bucket")
+	}
+}
+
+func TestLimiterMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	limiter := NewLimiter(NewMemoryBackend(), PerAPIKey(Limit{Rate: 0.1, Burst: 1}))
+	// Only keys k1 and k2 are authenticated
+	authenticate := func(c *gin.Context) {
+		if key := c.GetHeader(APIKeyHeader); key == "k1" || key == "k2" {
+			c.Set(APIKeyIDKey, "id-"+key)
+		}
+	}
+	r.POST("/users", authenticate, limiter.Middleware(), func(c *gin.Context) { c.Status(http.StatusAccepted) })
+
+	request := func(key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/users", nil)
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	if w := request("k1"); w.Code != http.StatusAccepted {
+		t.Fatalf("Unexpected status %v", w.Code)
+	}
+	w := request("k1")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "10" {
+		t.Fatalf("Unexpected status %v retry after %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := request("k2"); w.Code != http.StatusAccepted {
+		t.Fatalf("Unexpected status %v", w.Code)
+	}
+	// Requests without authenticated API key are not limited by the API key rule
+	for i := 0; i < 3; i++ {
+		if w := request(""); w.Code != http.StatusAccepted {
+			t.Fatalf("Unexpected status %v", w.Code)
+		}
+		if w := request(fmt.Sprintf("forged%d", i)); w.Code != http.StatusAccepted {
+			t.Fatalf("Unexpected status %v", w.Code)
+		}
+	}
+}
+
+func TestProofOfWork(t *testing.T) {
+	pow, err := NewProofOfWork(8, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := pow.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	solution := ""
+	for i := 0; ; i++ {
+		solution = strconv.Itoa(i)
+		if leadingZeroBits(sha256.Sum256([]byte(challenge+":"+solution))) >= 8 {
+			break
+		}
+	}
+	if err := pow.check(challenge, solution); err != nil {
+		t.Fatal(err)
+	}
+	if err := pow.check(challenge, solution); !errors.Is(err, ErrChallengeFailed) {
+		t.Fatalf("Challenge must be accepted once, got %v", err)
+	}
+	if err := pow.check(challenge[:len(challenge)-1]+"0", solution); !errors.Is(err, ErrChallengeFailed) {
+		t.Fatalf("Expected ErrChallengeFailed for forged challenge, got %v", err)
+	}
+	if err := pow.check("", ""); !errors.Is(err, ErrChallengeRequired) {
+		t.Fatalf("Expected ErrChallengeRequired, got %v", err)
+	}
+}
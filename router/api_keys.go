@@ -0,0 +1,148 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+	"github.com/torvald2/hack-fs-2023-promise-card/ratelimit"
+	"github.com/torvald2/hack-fs-2023-promise-card/usecases"
+)
+
+// Gin context key of the authenticated usecases.APIKey
+const APIKeyContextKey = "apikey"
+
+// Require api key with the scope in X-API-Key header.
+// Does nothing when api keys are not required
+func (u UserController) requireAPIKey(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if u.apiKeysRequired {
+			u.checkAPIKey(c, scope)
+		}
+	}
+}
+
+func (u UserController) checkAPIKey(c *gin.Context, scope string) {
+	value := c.GetHeader(ratelimit.APIKeyHeader)
+	if value == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, map[string]interface{}{"error": "api key required"})
+		return
+	}
+	key, err := usecases.AuthenticateAPIKey(u.store, value)
+	if errors.Is(err, usecases.ErrInvalidAPIKey) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if !key.HasScope(scope) {
+		c.AbortWithStatusJSON(http.StatusForbidden, map[string]interface{}{"error": "api key scope required: " + scope})
+		return
+	}
+	c.Set(APIKeyContextKey, key)
+	c.Set(ratelimit.APIKeyIDKey, key.ID)
+}
+
+// Admin access with admin scoped api key or bearer token of the admin user
+func (u UserController) requireAdmin() gin.HandlerFunc {
+	bearer := auth.Middleware(u.verifier)
+	role := auth.RequireRoles(u.userRoles, auth.RoleAdmin)
+	return func(c *gin.Context) {
+		if c.GetHeader(ratelimit.APIKeyHeader) != "" {
+			u.checkAPIKey(c, usecases.ScopeAdmin)
+			return
+		}
+		bearer(c)
+		if !c.IsAborted() {
+			role(c)
+		}
+	}
+}
+
+// Bearer token of a user that is not disabled. Access tokens issued before the user
+// was disabled are refused, roles of the claims are loaded from the user record
+func (u UserController) requireUser() gin.HandlerFunc {
+	bearer := auth.Middleware(u.verifier)
+	return func(c *gin.Context) {
+		bearer(c)
+		if c.IsAborted() {
+			return
+		}
+		claims, _ := auth.GetClaims(c)
+		roles, err := u.userRoles(claims.Subject)
+		if errors.Is(err, usecases.ErrUserDisabled) {
+			c.AbortWithStatusJSON(http.StatusForbidden, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		claims.Roles = roles
+	}
+}
+
+// Roles of the user record, the roles claim of the token is not trusted
+func (u UserController) userRoles(subject string) ([]string, error) {
+	return usecases.UserRoles(u.store, subject)
+}
+
+type APIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type APIKeyResponse struct {
+	usecases.APIKey
+	Key string `json:"key,omitempty"`
+}
+
+func (u UserController) MintAPIKey(c *gin.Context) {
+	var body APIKeyRequest
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"err": err.Error()})
+		return
+	}
+	key, value, err := usecases.MintAPIKey(u.store, body.Name, body.Scopes)
+	if errors.Is(err, usecases.ErrUnknownScope) {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	key.SecretHash = ""
+	c.JSON(http.StatusCreated, APIKeyResponse{APIKey: key, Key: value})
+}
+
+func (u UserController) ListAPIKeys(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	keys, next, err := usecases.ListAPIKeys(u.store, c.Query("cursor"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	for i := range keys {
+		keys[i].SecretHash = ""
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{"keys": keys, "next": next})
+}
+
+func (u UserController) RevokeAPIKey(c *gin.Context) {
+	err := usecases.RevokeAPIKey(u.store, c.Param("id"))
+	if errors.Is(err, polybase.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
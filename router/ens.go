@@ -0,0 +1,66 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/torvald2/hack-fs-2023-promise-card/ens"
+	"github.com/torvald2/hack-fs-2023-promise-card/usecases"
+)
+
+type ReverseResponse struct {
+	Address string `json:"address"`
+	Name    string `json:"name"`
+}
+
+type NickAvailabilityResponse struct {
+	Nick      string `json:"nick"` // normalized nick
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+}
+
+func (u UserController) ResolveName(c *gin.Context) {
+	resolution, err := usecases.ResolveName(u.ensService, c.Param("name"))
+	if err != nil {
+		ensError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resolution)
+}
+
+func (u UserController) ReverseResolve(c *gin.Context) {
+	address := c.Param("address")
+	name, err := usecases.ReverseResolve(u.ensService, address)
+	if err != nil {
+		ensError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ReverseResponse{Address: address, Name: name})
+}
+
+func ensError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ens.ErrBadAddress), errors.Is(err, ens.ErrBadLabel):
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+	case errors.Is(err, ens.ErrNoName):
+		c.JSON(http.StatusNotFound, map[string]interface{}{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// Nick availability for the frontend, invalid nick is a bad request
+func (u UserController) CheckNick(c *gin.Context) {
+	nick, err := ens.NormalizeLabel(c.Query("nick"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	_, err = usecases.CheckNick(u.store, u.ensService, nick)
+	if err != nil && !errors.Is(err, ens.ErrNameTaken) {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, NickAvailabilityResponse{Nick: nick, Name: u.ensService.Subdomain(nick), Available: err == nil})
+}
@@ -0,0 +1,189 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+	"github.com/torvald2/hack-fs-2023-promise-card/usecases"
+)
+
+func (u UserController) oidcProvider() usecases.OIDCProvider {
+	users := usecases.NewGetUserUseCase(u.store, u.network, u.sessions, u.ensService)
+	return usecases.NewOIDCProvider(users)
+}
+
+func (u UserController) GetOpenIDConfiguration(c *gin.Context) {
+	base := strings.TrimSuffix(u.issuer.Name, "/")
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"issuer":                                base,
+		"authorization_endpoint":                base + "/oauth/authorize",
+		"token_endpoint":                        base + "/oauth/token",
+		"userinfo_endpoint":                     base + "/oauth/userinfo",
+		"jwks_uri":                              base + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{u.issuer.Keyring().Active().Alg},
+		"scopes_supported":                      []string{"openid", "profile"},
+		"token_endpoint_auth_methods_supported": []string{"none", "client_secret_post", "client_secret_basic"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"sub", "nick", "preferred_username", "ens_name", "avatar", "picture"},
+	})
+}
+
+type AuthorizeRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientID            string `form:"client_id" json:"client_id"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	Nonce               string `form:"nonce" json:"nonce"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+// Authorization endpoint. The browser is sent to the login page of the promise card app
+func (u UserController) AuthorizeRedirect(c *gin.Context) {
+	var body AuthorizeRequest
+	if err := c.ShouldBindQuery(&body); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"err": err.Error()})
+		return
+	}
+	provider := u.oidcProvider()
+	redirect, err := provider.LoginRedirect(usecases.AuthorizeRequest(body), u.oidcLoginURL)
+	var oauthErr *usecases.OAuthError
+	if errors.As(err, &oauthErr) {
+		c.JSON(http.StatusBadRequest, oauthErr)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// Completes the authorization request. Called by the promise card app login page with the user token,
+// the app sends the browser to the returned redirect
+func (u UserController) Authorize(c *gin.Context) {
+	var body AuthorizeRequest
+	if err := c.ShouldBind(&body); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"err": err.Error()})
+		return
+	}
+	claims, _ := auth.GetClaims(c)
+	provider := u.oidcProvider()
+	redirect, err := provider.Authorize(usecases.AuthorizeRequest(body), claims.Subject)
+	var oauthErr *usecases.OAuthError
+	if errors.As(err, &oauthErr) {
+		c.JSON(http.StatusBadRequest, oauthErr)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]string{"redirect_to": redirect})
+}
+
+type OIDCTokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+}
+
+func (u UserController) OIDCToken(c *gin.Context) {
+	var body OIDCTokenRequest
+	if err := c.ShouldBind(&body); err != nil {
+		c.JSON(http.StatusBadRequest, usecases.OAuthError{Code: "invalid_request", Description: err.Error()})
+		return
+	}
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		body.ClientID, body.ClientSecret = id, secret
+	}
+	provider := u.oidcProvider()
+	tokens, err := provider.Exchange(usecases.OIDCTokenRequest(body))
+	var oauthErr *usecases.OAuthError
+	if errors.As(err, &oauthErr) {
+		status := http.StatusBadRequest
+		if oauthErr.Code == "invalid_client" {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, oauthErr)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (u UserController) UserInfo(c *gin.Context) {
+	claims, _ := auth.GetClaims(c)
+	provider := u.oidcProvider()
+	info, err := provider.UserInfo(claims.Subject)
+	if errors.Is(err, polybase.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+type OAuthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Confidential bool     `json:"confidential"`
+}
+
+type OAuthClientResponse struct {
+	usecases.OAuthClient
+	Secret string `json:"client_secret,omitempty"`
+}
+
+func (u UserController) RegisterOAuthClient(c *gin.Context) {
+	var body OAuthClientRequest
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"err": err.Error()})
+		return
+	}
+	client, secret, err := usecases.RegisterOAuthClient(u.store, body.Name, body.RedirectURIs, body.Confidential)
+	var oauthErr *usecases.OAuthError
+	if errors.As(err, &oauthErr) {
+		c.JSON(http.StatusBadRequest, oauthErr)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	client.SecretHash = ""
+	c.JSON(http.StatusCreated, OAuthClientResponse{OAuthClient: client, Secret: secret})
+}
+
+func (u UserController) ListOAuthClients(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	clients, next, err := usecases.ListOAuthClients(u.store, c.Query("cursor"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	for i := range clients {
+		clients[i].SecretHash = ""
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{"clients": clients, "next": next})
+}
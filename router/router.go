@@ -1,32 +1,68 @@
 package router
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/gin-gonic/gin"
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
+	"github.com/torvald2/hack-fs-2023-promise-card/ens"
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+	"github.com/torvald2/hack-fs-2023-promise-card/ratelimit"
+	"github.com/torvald2/hack-fs-2023-promise-card/timelock"
 	"github.com/torvald2/hack-fs-2023-promise-card/usecases"
+	"go.uber.org/zap"
 )
 
 type UserController struct {
-	key           string
-	url           string
-	namespace     string
-	tlUrl         string
-	tlHash        string
-	pinataKey     string
-	ensRootOwner  string
-	ensPrivateKey string
-	mainEns       string
-	rpcUrl        string
-	resolver      string
-	nonces        map[string]string
+	store       polybase.RecordStore
+	network     timelock.Network
+	issuer      *auth.Issuer
+	sessions    *usecases.SessionUseCase
+	verifier    *auth.Verifier
+	pinataKey   string
+	ensService  *ens.ENSAdaptor
+	siweDomain  string
+	siweChainID int64
+	nonces      *auth.NonceStore
+	provisioner *usecases.Provisioner
+	// POST /users and POST /token require api keys
+	apiKeysRequired bool
+	// Login page of GET /oauth/authorize
+	oidcLoginURL string
 }
 
 type CreateUserRequest struct {
-	Nick          string `json:"nick"`
+	Nick          string                   `json:"nick"`
+	AvalibleAfter int                      `json:"valible_after_hours"`
+	Avatar        string                   `json:"avatar"`
+	Schedule      []SchedulePayloadRequest `json:"schedule"`
+	Shamir        *ShamirRequest           `json:"shamir"`
+}
+type SchedulePayloadRequest struct {
+	Label         string `json:"label"`
+	Payload       string `json:"payload"` // base64 encoded
 	AvalibleAfter int    `json:"valible_after_hours"`
-	Avatar        string `json:"avatar"`
+}
+type CreateUserJobResponse struct {
+	JobID string `json:"job_id"`
+}
+type ShamirRequest struct {
+	Threshold      int      `json:"threshold"`
+	TimelockShares []int    `json:"timelock_shares_after_hours"`
+	Guardians      []string `json:"guardians"`
+}
+type TokenRequest struct {
+	PublicKey           string   `json:"public_key"`
+	PrivateKeyEncrypted string   `json:"private_key_encrypted"`
+	Shares              []string `json:"shares"`
 }
 type CreateUserResponse struct {
 	PublicKey           string `json:"public_key"`
@@ -39,54 +75,626 @@ func (u UserController) CreateUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, map[string]interface{}{"err": err.Error()})
 		return
 	}
-	duration := time.Duration(body.AvalibleAfter) * time.Hour
-	us := usecases.NewCreateUserUseCase(u.key, u.url, u.namespace, u.tlUrl, u.tlHash, u.pinataKey, u.ensRootOwner, u.ensPrivateKey, u.mainEns, u.rpcUrl, u.resolver)
-	err := us.Execute(body.Nick, duration, body.Avatar)
+	req := usecases.ProvisionRequest{
+		Nick:     body.Nick,
+		Duration: time.Duration(body.AvalibleAfter) * time.Hour,
+		Avatar:   body.Avatar,
+	}
+	for _, p := range body.Schedule {
+		data, err := base64.StdEncoding.DecodeString(p.Payload)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		req.Schedule = append(req.Schedule, usecases.PayloadSpec{
+			Label: p.Label,
+			Data:  data,
+			After: time.Duration(p.AvalibleAfter) * time.Hour,
+		})
+	}
+	if body.Shamir != nil {
+		req.Shamir = &usecases.ShamirSpec{
+			Threshold: body.Shamir.Threshold,
+			Guardians: body.Shamir.Guardians,
+		}
+		for _, hours := range body.Shamir.TimelockShares {
+			req.Shamir.TimelockShares = append(req.Shamir.TimelockShares, time.Duration(hours)*time.Hour)
+		}
+	}
+	job, err := u.provisioner.Enqueue(req)
+	if errors.Is(err, usecases.ErrInvalidPayload) || errors.Is(err, usecases.ErrInvalidShares) || errors.Is(err, ens.ErrBadLabel) {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, ens.ErrNameTaken) {
+		c.JSON(http.StatusConflict, map[string]interface{}{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, CreateUserResponse{
-		PublicKey:           us.GetAddress(),
-		PrivateKeyEncrypted: us.GetPrivateKey(),
-	})
+	c.JSON(http.StatusAccepted, CreateUserJobResponse{JobID: job.ID})
 
 }
 
 func (u UserController) GetUser(c *gin.Context) {
-	var body CreateUserResponse
+	var body TokenRequest
 	if err := c.BindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, map[string]interface{}{"err": err.Error()})
 		return
 	}
-	us := usecases.NewGetUserUseCase(u.key, u.url, u.namespace, u.tlUrl, u.tlHash, u.pinataKey, u.ensRootOwner, u.ensPrivateKey, u.mainEns, u.rpcUrl, u.resolver)
-	token, err := us.Execute(body.PrivateKeyEncrypted, body.PublicKey)
+	us := usecases.NewGetUserUseCase(u.store, u.network, u.sessions, u.ensService)
+	tokens, err := us.Execute(body.PrivateKeyEncrypted, body.PublicKey, body.Shares)
+	var locked *timelock.LockedError
+	if errors.As(err, &locked) {
+		c.JSON(http.StatusLocked, map[string]interface{}{
+			"error":             err.Error(),
+			"unlock_at":         locked.UnlockAt,
+			"remaining_seconds": int64(math.Ceil(locked.Remaining().Seconds())),
+		})
+		return
+	}
+	if errors.Is(err, usecases.ErrUserDisabled) {
+		c.JSON(http.StatusForbidden, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, usecases.ErrInvalidShares) || errors.Is(err, usecases.ErrNotEnoughShares) {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, map[string]string{"token": token})
+	c.JSON(http.StatusOK, tokens)
+
+}
 
+type CardTokenRequest struct {
+	Token string `json:"token"`
 }
 
-func NewRouter(key, url, namespace, tlUrl, tlHash, pinataKey, ensRootOwner, ensPrivateKey, mainEns, rpcUrl, resolver string) *gin.Engine {
+// Exchange ES256K token signed with the card key for the service tokens
+func (u UserController) ExchangeCardToken(c *gin.Context) {
+	var body CardTokenRequest
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"err": err.Error()})
+		return
+	}
+	claims, err := u.verifier.VerifyCardToken(body.Token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	us := usecases.NewGetUserUseCase(u.store, u.network, u.sessions, u.ensService)
+	tokens, err := us.ExchangeCardToken(claims.Subject)
+	if errors.Is(err, polybase.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, map[string]interface{}{"error": "unknown card"})
+		return
+	}
+	if errors.Is(err, usecases.ErrUserDisabled) {
+		c.JSON(http.StatusForbidden, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (u UserController) GetNonce(c *gin.Context) {
+	address := c.Query("address")
+	if !common.IsHexAddress(address) {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": "bad address"})
+		return
+	}
+	nonce, err := u.nonces.Issue(address)
+	if errors.Is(err, auth.ErrTooManyNonces) {
+		c.JSON(http.StatusServiceUnavailable, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]string{"nonce": nonce})
+}
+
+type SIWERequest struct {
+	Message   string `json:"message"`
+	Signature string `json:"signature"`
+}
+
+func (u UserController) SignInWithEthereum(c *gin.Context) {
+	var body SIWERequest
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"err": err.Error()})
+		return
+	}
+	users := usecases.NewGetUserUseCase(u.store, u.network, u.sessions, u.ensService)
+	us := usecases.NewSIWELoginUseCase(users, u.nonces, u.siweDomain, u.siweChainID)
+	tokens, err := us.Execute(body.Message, body.Signature)
+	signInResponse(c, tokens, err)
+}
+
+type ChallengeRequest struct {
+	Address string `json:"address"`
+}
+
+func (u UserController) GetChallenge(c *gin.Context) {
+	var body ChallengeRequest
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"err": err.Error()})
+		return
+	}
+	users := usecases.NewGetUserUseCase(u.store, u.network, u.sessions, u.ensService)
+	us := usecases.NewProveKeyUseCase(users, u.nonces)
+	challenge, err := us.Challenge(body.Address)
+	if errors.Is(err, polybase.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, challenge)
+}
+
+type ProveKeyRequest struct {
+	Address   string `json:"address"`
+	Nonce     string `json:"nonce"`
+	Signature string `json:"signature"`
+}
+
+func (u UserController) ProveKey(c *gin.Context) {
+	var body ProveKeyRequest
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"err": err.Error()})
+		return
+	}
+	users := usecases.NewGetUserUseCase(u.store, u.network, u.sessions, u.ensService)
+	us := usecases.NewProveKeyUseCase(users, u.nonces)
+	tokens, err := us.Execute(body.Address, body.Nonce, body.Signature)
+	signInResponse(c, tokens, err)
+}
+
+// Response of the signature based logins
+func signInResponse(c *gin.Context, tokens usecases.TokenPair, err error) {
+	var locked *timelock.LockedError
+	if errors.As(err, &locked) {
+		c.JSON(http.StatusLocked, map[string]interface{}{
+			"error":             err.Error(),
+			"unlock_at":         locked.UnlockAt,
+			"remaining_seconds": int64(math.Ceil(locked.Remaining().Seconds())),
+		})
+		return
+	}
+	if errors.Is(err, usecases.ErrUserDisabled) {
+		c.JSON(http.StatusForbidden, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, auth.ErrBadSIWEMessage) {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, auth.ErrBadSIWESignature) || errors.Is(err, auth.ErrBadSignature) || errors.Is(err, usecases.ErrKeyNotProved) ||
+		errors.Is(err, usecases.ErrInvalidNonce) || errors.Is(err, polybase.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+func (u UserController) GrantRole(c *gin.Context) {
+	var body RoleRequest
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"err": err.Error()})
+		return
+	}
+	roles, err := usecases.GrantRole(u.store, c.Param("address"), body.Role)
+	u.rolesResponse(c, roles, err)
+}
+
+func (u UserController) RevokeRole(c *gin.Context) {
+	roles, err := usecases.RevokeRole(u.store, c.Param("address"), c.Param("role"))
+	u.rolesResponse(c, roles, err)
+}
+
+func (u UserController) rolesResponse(c *gin.Context, roles []string, err error) {
+	if errors.Is(err, usecases.ErrUnknownRole) {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, polybase.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{"roles": roles})
+}
+
+type UserListResponse struct {
+	Users []usecases.UserSummary `json:"users"`
+	Next  string                 `json:"next"`
+}
+
+func (u UserController) ListUsers(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	filter := usecases.UserFilter{Nick: c.Query("nick")}
+	for param, t := range map[string]*time.Time{"created_after": &filter.CreatedAfter, "created_before": &filter.CreatedBefore} {
+		if v := c.Query(param); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+				return
+			}
+			*t = parsed
+		}
+	}
+	users, next, err := usecases.ListUsers(u.store, filter, c.Query("cursor"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, UserListResponse{Users: users, Next: next})
+}
+
+func (u UserController) GetUserDetails(c *gin.Context) {
+	us := usecases.NewAdminUseCase(u.store, u.pinataKey, u.ensService)
+	details, err := us.GetUser(c.Param("address"))
+	if errors.Is(err, polybase.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, details)
+}
+
+func (u UserController) DisableUser(c *gin.Context) {
+	u.setUserDisabled(c, true)
+}
+
+func (u UserController) EnableUser(c *gin.Context) {
+	u.setUserDisabled(c, false)
+}
+
+func (u UserController) setUserDisabled(c *gin.Context, disabled bool) {
+	err := usecases.SetUserDisabled(u.store, c.Param("address"), disabled)
+	if errors.Is(err, polybase.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{"disabled": disabled})
+}
+
+func (u UserController) GetSealedKey(c *gin.Context) {
+	key, err := usecases.GetSealedKey(u.store, c.Param("address"))
+	if errors.Is(err, polybase.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, key)
+}
+
+func (u UserController) GetSchedule(c *gin.Context) {
+	schedule, err := usecases.GetSchedule(u.store, u.network, c.Param("address"))
+	if errors.Is(err, polybase.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{"schedule": schedule})
+}
+
+func (u UserController) GetKeyShares(c *gin.Context) {
+	shares, err := usecases.GetKeyShares(u.store, u.network, c.Param("address"))
+	if errors.Is(err, polybase.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, shares)
+}
+
+func (u UserController) GetJWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, u.issuer.Keyring().JWKS())
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (u UserController) RefreshToken(c *gin.Context) {
+	var body RefreshRequest
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"err": err.Error()})
+		return
+	}
+	tokens, err := u.sessions.Refresh(body.RefreshToken)
+	if errors.Is(err, usecases.ErrInvalidRefreshToken) {
+		c.JSON(http.StatusUnauthorized, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, usecases.ErrUserDisabled) {
+		c.JSON(http.StatusForbidden, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (u UserController) Logout(c *gin.Context) {
+	var body RefreshRequest
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"err": err.Error()})
+		return
+	}
+	err := u.sessions.Logout(body.RefreshToken)
+	if errors.Is(err, usecases.ErrInvalidRefreshToken) {
+		c.JSON(http.StatusUnauthorized, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type IntrospectRequest struct {
+	Token string `form:"token" json:"token"`
+}
+
+// RFC 7662 token introspection
+func (u UserController) IntrospectToken(c *gin.Context) {
+	var body IntrospectRequest
+	if err := c.ShouldBind(&body); err != nil || body.Token == "" {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": "token required"})
+		return
+	}
+	claims, err := u.verifier.Verify(body.Token)
+	if err == nil {
+		// Tokens of disabled users are not active until they expire
+		_, err = u.userRoles(claims.Subject)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, map[string]interface{}{"active": false})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"active":     true,
+		"token_type": "Bearer",
+		"sub":        claims.Subject,
+		"iss":        claims.Issuer,
+		"exp":        claims.ExpiresAt,
+		"iat":        claims.IssuedAt,
+		"nbf":        claims.NotBefore,
+		"dat":        claims.Data,
+	})
+}
+
+type UnlockStatusRequest struct {
+	PrivateKeyEncrypted string `json:"private_key_encrypted"`
+}
+
+func (u UserController) GetUnlockStatus(c *gin.Context) {
+	var body UnlockStatusRequest
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"err": err.Error()})
+		return
+	}
+	us := usecases.NewUnlockStatusUseCase(u.network)
+	status, err := us.Execute(body.PrivateKeyEncrypted)
+	var hexErr hex.InvalidByteError
+	if errors.Is(err, timelock.ErrBadCiphertext) || errors.Is(err, timelock.ErrWrongChain) || errors.Is(err, hex.ErrLength) || errors.As(err, &hexErr) {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": err.Error(), "status": status})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// Job status for anyone with the job id. The sealed key is not included,
+// it is served by GET /users/:address/sealed-key once the user record is created
+type JobResponse struct {
+	ID          string             `json:"id"`
+	Kind        string             `json:"kind,omitempty"`
+	Status      string             `json:"status"`
+	Steps       []usecases.JobStep `json:"steps"`
+	PublicKey   string             `json:"public_key,omitempty"`
+	CID         string             `json:"cid,omitempty"`
+	SubdomainTx []ens.TxRecord     `json:"subdomain_txs,omitempty"`
+	AvatarTx    []ens.TxRecord     `json:"avatar_txs,omitempty"`
+	ReleaseTx   []ens.TxRecord     `json:"release_txs,omitempty"`
+	ReverseTx   []ens.TxRecord     `json:"reverse_txs,omitempty"`
+	HandoverTx  []ens.TxRecord     `json:"handover_txs,omitempty"`
+	RecordsTx   []ens.TxRecord     `json:"records_txs,omitempty"`
+	Error       string             `json:"error,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+	// Deprecated: hash of the last transaction of subdomain_txs, avatar_txs and release_txs
+	LegacySubdomainTx string `json:"subdomain_tx,omitempty"`
+	LegacyAvatarTx    string `json:"avatar_tx,omitempty"`
+	LegacyReleaseTx   string `json:"release_tx,omitempty"`
+}
+
+func lastTxHash(txs []ens.TxRecord) string {
+	if len(txs) == 0 {
+		return ""
+	}
+	return txs[len(txs)-1].Hash
+}
+
+func (u UserController) GetJob(c *gin.Context) {
+	job, err := usecases.GetJob(u.store, c.Param("id"))
+	if errors.Is(err, polybase.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, JobResponse{
+		ID:                job.ID,
+		Kind:              job.Kind,
+		Status:            job.Status,
+		Steps:             job.Steps,
+		PublicKey:         job.Address,
+		CID:               job.CID,
+		SubdomainTx:       job.SubdomainTx,
+		AvatarTx:          job.AvatarTx,
+		ReleaseTx:         job.ReleaseTx,
+		ReverseTx:         job.ReverseTx,
+		HandoverTx:        job.HandoverTx,
+		RecordsTx:         job.RecordsTx,
+		LegacySubdomainTx: lastTxHash(job.SubdomainTx),
+		LegacyAvatarTx:    lastTxHash(job.AvatarTx),
+		LegacyReleaseTx:   lastTxHash(job.ReleaseTx),
+		Error:             job.Error,
+		CreatedAt:         job.CreatedAt,
+		UpdatedAt:         job.UpdatedAt,
+	})
+}
+
+type ReconciliationResponse struct {
+	Entries []usecases.ReconciliationEntry `json:"entries"`
+	Next    string                         `json:"next"`
+}
+
+func (u UserController) ListReconciliation(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	entries, next, err := usecases.ListReconciliation(u.store, c.Query("job"), c.Query("cursor"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, ReconciliationResponse{Entries: entries, Next: next})
+}
+
+// Outstanding login nonces of all clients, every nonce is kept for 5 minutes
+const maxNonces = 10000
+
+// Router of the service API. Returned stop function stops provisioning workers and waits
+// for the running jobs until the context is done, it must be called before the ENS service is closed
+func NewRouter(store polybase.RecordStore, network timelock.Network, sessions *usecases.SessionUseCase, protection ratelimit.Protection, pinataKey string, ensService *ens.ENSAdaptor, siweDomain string, siweChainID int64, oidcLoginURL string, apiKeysRequired bool) (*gin.Engine, func(ctx context.Context) error) {
 	usrController := UserController{
-		key:           key,
-		url:           url,
-		namespace:     namespace,
-		tlUrl:         tlUrl,
-		tlHash:        tlHash,
-		pinataKey:     pinataKey,
-		ensRootOwner:  ensRootOwner,
-		ensPrivateKey: ensPrivateKey,
-		mainEns:       mainEns,
-		rpcUrl:        rpcUrl,
-		resolver:      resolver,
+		store:       store,
+		network:     network,
+		issuer:      sessions.Issuer(),
+		sessions:    sessions,
+		verifier:    auth.NewVerifier(sessions.Issuer().Name, sessions.Issuer().Keyring()),
+		pinataKey:   pinataKey,
+		ensService:  ensService,
+		siweDomain:  siweDomain,
+		siweChainID: siweChainID,
+		nonces:      auth.NewNonceStore(5*time.Minute, maxNonces),
+	}
+	usrController.apiKeysRequired = apiKeysRequired
+	usrController.oidcLoginURL = oidcLoginURL
+	createUser := usecases.NewCreateUserUseCase(store, network, pinataKey, ensService)
+	usrController.provisioner = usecases.NewProvisioner(store, createUser)
+	// Single worker keeps ENS transactions from the owner wallet sequential
+	usrController.provisioner.Start(1)
+	if err := usrController.provisioner.Resume(); err != nil {
+		zap.L().Error("Resume provisioning jobs error", zap.Error(err))
 	}
 
 	r := gin.New()
 
-	r.POST("/users", usrController.CreateUser)
-	r.POST("/token", usrController.GetUser)
-	return r
+	r.GET("/.well-known/jwks.json", usrController.GetJWKS)
+	r.GET("/.well-known/openid-configuration", usrController.GetOpenIDConfiguration)
+	// API key is checked first so the limiter keys on the authenticated key
+	createUserHandlers := append([]gin.HandlerFunc{usrController.requireAPIKey(usecases.ScopeCreateUser)}, protection.Handlers()...)
+	r.POST("/users", append(createUserHandlers, usrController.CreateUser)...)
+	if pow, ok := protection.Challenge.(*ratelimit.ProofOfWork); ok {
+		r.GET("/pow/challenge", pow.IssueChallenge)
+	}
+	checkNick := []gin.HandlerFunc{usrController.CheckNick}
+	if protection.Lookups != nil {
+		checkNick = append([]gin.HandlerFunc{protection.Lookups.Middleware()}, checkNick...)
+	}
+	r.GET("/users/available", checkNick...)
+	r.GET("/users/:address/sealed-key", usrController.GetSealedKey)
+	r.GET("/users/:address/schedule", usrController.GetSchedule)
+	r.GET("/users/:address/shares", usrController.GetKeyShares)
+	r.GET("/users/:address/records", usrController.GetTextRecords)
+	updateRecords := []gin.HandlerFunc{usrController.requireUser()}
+	if protection.Records != nil {
+		updateRecords = append(updateRecords, protection.Records.Middleware())
+	}
+	r.PUT("/users/:address/records", append(updateRecords, usrController.UpdateTextRecords)...)
+	r.POST("/token", usrController.requireAPIKey(usecases.ScopeIssueToken), usrController.GetUser)
+	r.POST("/token/exchange", usrController.requireAPIKey(usecases.ScopeIssueToken), usrController.ExchangeCardToken)
+	r.POST("/token/introspect", usrController.IntrospectToken)
+	r.POST("/token/refresh", usrController.RefreshToken)
+	r.POST("/token/challenge", usrController.GetChallenge)
+	r.POST("/token/prove", usrController.ProveKey)
+	r.POST("/logout", usrController.Logout)
+	getNonce := []gin.HandlerFunc{usrController.GetNonce}
+	if protection.Nonces != nil {
+		getNonce = append([]gin.HandlerFunc{protection.Nonces.Middleware()}, getNonce...)
+	}
+	r.GET("/auth/nonce", getNonce...)
+	r.POST("/auth/siwe", usrController.SignInWithEthereum)
+	r.POST("/timelock/inspect", usrController.GetUnlockStatus)
+	r.GET("/ens/reverse/:address", usrController.ReverseResolve)
+	r.GET("/ens/:name", usrController.ResolveName)
+	r.GET("/jobs/:id", usrController.GetJob)
+	r.GET("/oauth/authorize", usrController.AuthorizeRedirect)
+	r.POST("/oauth/authorize", usrController.requireUser(), usrController.Authorize)
+	r.POST("/oauth/token", usrController.OIDCToken)
+	r.GET("/oauth/userinfo", usrController.requireUser(), usrController.UserInfo)
+
+	admin := r.Group("/admin", usrController.requireAdmin())
+	admin.GET("/users", usrController.ListUsers)
+	admin.GET("/reconciliation", usrController.ListReconciliation)
+	admin.GET("/users/:address", usrController.GetUserDetails)
+	admin.POST("/users/:address/disable", usrController.DisableUser)
+	admin.POST("/users/:address/enable", usrController.EnableUser)
+	admin.POST("/users/:address/roles", usrController.GrantRole)
+	admin.DELETE("/users/:address/roles/:role", usrController.RevokeRole)
+	admin.POST("/oauth/clients", usrController.RegisterOAuthClient)
+	admin.GET("/oauth/clients", usrController.ListOAuthClients)
+	admin.POST("/api-keys", usrController.MintAPIKey)
+	admin.GET("/api-keys", usrController.ListAPIKeys)
+	admin.DELETE("/api-keys/:id", usrController.RevokeAPIKey)
+	return r, usrController.provisioner.Stop
 }
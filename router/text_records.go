@@ -0,0 +1,73 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
+	"github.com/torvald2/hack-fs-2023-promise-card/ens"
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+	"github.com/torvald2/hack-fs-2023-promise-card/usecases"
+)
+
+type TextRecordsRequest struct {
+	Records map[string]string `json:"records"` // empty value removes the record
+}
+
+type TextRecordsResponse struct {
+	Records map[string]string `json:"records"`
+	JobID   string            `json:"job_id,omitempty"` // update job, GET /jobs/:id
+}
+
+// Text records of the user subdomain, keys are comma separated in the keys query
+func (u UserController) GetTextRecords(c *gin.Context) {
+	var keys []string
+	if query := c.Query("keys"); query != "" {
+		keys = strings.Split(query, ",")
+	}
+	us := usecases.NewTextRecordsUseCase(u.store, u.ensService)
+	records, err := us.Get(c.Param("address"), keys)
+	if err != nil {
+		textRecordsError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, TextRecordsResponse{Records: records})
+}
+
+// Queue text records update of the own subdomain, admins can update any user
+func (u UserController) UpdateTextRecords(c *gin.Context) {
+	claims, _ := auth.GetClaims(c)
+	address := c.Param("address")
+	if !strings.EqualFold(claims.Subject, address) && !claims.HasRole(auth.RoleAdmin) {
+		c.JSON(http.StatusForbidden, map[string]interface{}{"error": "not the subdomain user"})
+		return
+	}
+	var body TextRecordsRequest
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"err": err.Error()})
+		return
+	}
+	job, err := u.provisioner.EnqueueTextRecords(address, body.Records)
+	if err != nil {
+		textRecordsError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, TextRecordsResponse{Records: body.Records, JobID: job.ID})
+}
+
+func textRecordsError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ens.ErrBadTextKey), errors.Is(err, usecases.ErrTextRecordsLimit):
+		c.JSON(http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+	case errors.Is(err, polybase.ErrNotFound):
+		c.JSON(http.StatusNotFound, map[string]interface{}{"error": err.Error()})
+	case errors.Is(err, usecases.ErrUserDisabled):
+		c.JSON(http.StatusForbidden, map[string]interface{}{"error": err.Error()})
+	case errors.Is(err, ens.ErrNotCustodian):
+		c.JSON(http.StatusConflict, map[string]interface{}{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+	}
+}
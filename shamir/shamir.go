@@ -0,0 +1,116 @@
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Shamir secret sharing over GF(2^8).
+// Every share is the secret sized y values followed by the x coordinate byte
+
+var (
+	ErrBadShares = errors.New("bad shares")
+)
+
+// Split secret into parts shares, any threshold of them restore the secret
+func Split(secret []byte, parts, threshold int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("empty secret")
+	}
+	if threshold < 2 || parts < threshold || parts > 255 {
+		return nil, fmt.Errorf("bad threshold %d of %d parts", threshold, parts)
+	}
+	shares := make([][]byte, parts)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+	coefficients := make([]byte, threshold)
+	for i, b := range secret {
+		coefficients[0] = b
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+		for _, share := range shares {
+			share[i] = evaluate(coefficients, share[len(secret)])
+		}
+	}
+	return shares, nil
+}
+
+// Restore secret from the shares with Lagrange interpolation at zero
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, fmt.Errorf("%w: at least two shares required", ErrBadShares)
+	}
+	size := len(shares[0])
+	if size < 2 {
+		return nil, fmt.Errorf("%w: share is too short", ErrBadShares)
+	}
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool)
+	for i, share := range shares {
+		if len(share) != size {
+			return nil, fmt.Errorf("%w: shares have different length", ErrBadShares)
+		}
+		x := share[size-1]
+		if x == 0 || seen[x] {
+			return nil, fmt.Errorf("%w: duplicated share", ErrBadShares)
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+	secret := make([]byte, size-1)
+	for i := range secret {
+		var value byte
+		for j, share := range shares {
+			// Lagrange basis polynomial j at zero
+			basis := byte(1)
+			for k, x := range xs {
+				if k == j {
+					continue
+				}
+				basis = mul(basis, div(x, x^xs[j]))
+			}
+			value ^= mul(share[i], basis)
+		}
+		secret[i] = value
+	}
+	return secret, nil
+}
+
+// Evaluate polynomial at x with Horner's method
+func evaluate(coefficients []byte, x byte) byte {
+	var result byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = mul(result, x) ^ coefficients[i]
+	}
+	return result
+}
+
+// Multiplication in GF(2^8) with the AES polynomial
+func mul(a, b byte) byte {
+	var result byte
+	for b > 0 {
+		if b&1 == 1 {
+			result ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return result
+}
+
+// Division a/b, b must not be zero. Inverse is b^254
+func div(a, b byte) byte {
+	inverse := b
+	for i := 0; i < 253; i++ {
+		inverse = mul(inverse, b)
+	}
+	return mul(a, inverse)
+}
@@ -0,0 +1,37 @@
+package shamir
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		parts := make([][]byte, 0, len(subset))
+		for _, i := range subset {
+			parts = append(parts, shares[i])
+		}
+		restored, err := Combine(parts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(restored, secret) {
+			t.Errorf("Bad secret restored from %v", subset)
+		}
+	}
+	restored, err := Combine(shares[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(restored, secret) {
+		t.Error("Secret should not be restored below threshold")
+	}
+	if _, err := Combine([][]byte{shares[0], shares[0]}); err == nil {
+		t.Error("Duplicated shares should be rejected")
+	}
+}
@@ -0,0 +1,115 @@
+package timelock
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age/armor"
+)
+
+const ageIntro = "age-encryption.org/v1"
+
+var (
+	ErrBadCiphertext = errors.New("not a tlock ciphertext")
+	ErrWrongChain    = errors.New("ciphertext is encrypted for another drand chain")
+)
+
+// Parameters of the tlock stanza from the age header
+type Header struct {
+	Round     uint64
+	ChainHash string
+}
+
+type Status struct {
+	Round            uint64    `json:"round"`
+	ChainHash        string    `json:"chain_hash"`
+	UnlockAt         time.Time `json:"unlock_at"`
+	Decryptable      bool      `json:"decryptable"`
+	RemainingSeconds int64     `json:"remaining_seconds"`
+}
+
+// Returned when ciphertext round is not reached yet
+type LockedError struct {
+	Round    uint64
+	UnlockAt time.Time
+}
+
+func (e *LockedError) Remaining() time.Duration {
+	remaining := time.Until(e.UnlockAt)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("still locked until %s (round %d), remaining %s", e.UnlockAt.Format(time.RFC3339), e.Round, e.Remaining().Round(time.Second))
+}
+
+// Parse age header of the ciphertext without decryption
+func ParseHeader(ciphertext []byte) (Header, error) {
+	var src io.Reader = bytes.NewReader(ciphertext)
+	if bytes.HasPrefix(ciphertext, []byte(armor.Header)) {
+		src = armor.NewReader(src)
+	}
+	r := bufio.NewReader(src)
+	intro, err := r.ReadString('\n')
+	if err != nil || strings.TrimSuffix(intro, "\n") != ageIntro {
+		return Header{}, ErrBadCiphertext
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil || strings.HasPrefix(line, "---") {
+			return Header{}, ErrBadCiphertext
+		}
+		args := strings.Fields(strings.TrimPrefix(line, "->"))
+		if !strings.HasPrefix(line, "->") || len(args) != 3 || args[0] != "tlock" {
+			continue
+		}
+		round, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return Header{}, fmt.Errorf("%w: bad round %s", ErrBadCiphertext, args[1])
+		}
+		return Header{Round: round, ChainHash: args[2]}, nil
+	}
+}
+
+// Get unlock status of the ciphertext on the network
+func Inspect(network Network, ciphertext []byte) (Status, error) {
+	header, err := ParseHeader(ciphertext)
+	if err != nil {
+		return Status{}, err
+	}
+	status := Status{
+		Round:     header.Round,
+		ChainHash: header.ChainHash,
+	}
+	if header.ChainHash != network.ChainHash() {
+		return status, ErrWrongChain
+	}
+	status.UnlockAt = network.RoundTime(header.Round)
+	status.Decryptable = network.Current(time.Now()) >= header.Round
+	if !status.Decryptable {
+		status.RemainingSeconds = int64(math.Ceil(time.Until(status.UnlockAt).Seconds()))
+	}
+	return status, nil
+}
+
+// Return LockedError if ciphertext couldn't be decrypted yet
+func CheckUnlocked(network Network, ciphertext []byte) error {
+	status, err := Inspect(network, ciphertext)
+	if err != nil {
+		return err
+	}
+	if !status.Decryptable {
+		return &LockedError{Round: status.Round, UnlockAt: status.UnlockAt}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package timelock
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseHeader(t *testing.T) {
+	ciphertext := []byte("age-encryption.org/v1\n" +
+		"-> tlock 3102420 dbd506d6ef76e5f386f41c651dcb808c5bcbd75471cc4eafa3f4df7ad4e4c493\n" +
+		"kXyDKZ1AwLBnDzAsGKg6vGTYgQvy2OBmX9L7PcgQIm5FFXBP2Zp9ZaJMLuy1x6mU\n" +
+		"--- K1qYiIsLs8pxX1OrkvVu7PuKsw2FL6VvB3NnsOV24Wc\n" +
+		"binary payload")
+	header, err := ParseHeader(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Round != 3102420 {
+		t.Errorf("Bad round %d", header.Round)
+	}
+	if header.ChainHash != "dbd506d6ef76e5f386f41c651dcb808c5bcbd75471cc4eafa3f4df7ad4e4c493" {
+		t.Errorf("Bad chain hash %s", header.ChainHash)
+	}
+
+	if _, err := ParseHeader([]byte("age-encryption.org/v1\n-> X25519 abc\nbody\n--- mac\n")); !errors.Is(err, ErrBadCiphertext) {
+		t.Errorf("Expected ErrBadCiphertext, got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package timelock
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/drand/drand/chain"
+	"github.com/drand/drand/crypto"
+	"github.com/drand/kyber"
+	"github.com/drand/kyber/util/random"
+)
+
+// Drand network stand-in for tests and local development.
+// Beacons are signed by the local BLS key, rounds follow the wall clock
+// and could be moved forward manually with Advance
+type LocalNetwork struct {
+	mu        sync.RWMutex
+	scheme    crypto.Scheme
+	private   kyber.Scalar
+	public    kyber.Point
+	chainHash string
+	genesis   int64
+	period    time.Duration
+	shift     time.Duration
+}
+
+// Create local network. Nil seed generates a new random key,
+// the same seed gives the same key so ciphertexts survive restarts
+func NewLocalNetwork(seed []byte, genesis time.Time, period time.Duration) (*LocalNetwork, error) {
+	if period <= 0 {
+		return nil, fmt.Errorf("bad round period %s", period)
+	}
+	scheme, err := crypto.SchemeFromName(crypto.UnchainedSchemeID)
+	if err != nil {
+		return nil, err
+	}
+	private := scheme.KeyGroup.Scalar()
+	if seed == nil {
+		private.Pick(random.New())
+	} else {
+		hash := sha256.Sum256(seed)
+		private.SetBytes(hash[:])
+	}
+	public := scheme.KeyGroup.Point().Mul(private, nil)
+
+	publicBytes, err := public.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write(publicBytes)
+	binary.Write(h, binary.BigEndian, genesis.Unix())
+	binary.Write(h, binary.BigEndian, int64(period))
+	h.Write([]byte(scheme.Name))
+
+	return &LocalNetwork{
+		scheme:    *scheme,
+		private:   private,
+		public:    public,
+		chainHash: hex.EncodeToString(h.Sum(nil)),
+		genesis:   genesis.Unix(),
+		period:    period,
+	}, nil
+}
+
+// Move network clock forward by the number of rounds
+func (n *LocalNetwork) Advance(rounds uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.shift += time.Duration(rounds) * n.period
+}
+
+func (n *LocalNetwork) ChainHash() string {
+	return n.chainHash
+}
+
+func (n *LocalNetwork) Current(date time.Time) uint64 {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return chain.CurrentRound(date.Add(n.shift).Unix(), n.period, n.genesis)
+}
+
+func (n *LocalNetwork) PublicKey() kyber.Point {
+	return n.public
+}
+
+func (n *LocalNetwork) Scheme() crypto.Scheme {
+	return n.scheme
+}
+
+func (n *LocalNetwork) Signature(round uint64) ([]byte, error) {
+	if current := n.Current(time.Now()); round > current {
+		return nil, fmt.Errorf("round %d is not reached, current round %d", round, current)
+	}
+	beacon := chain.Beacon{Round: round}
+	return n.scheme.AuthScheme.Sign(n.private, n.scheme.DigestBeacon(&beacon))
+}
+
+func (n *LocalNetwork) RoundNumber(t time.Time) uint64 {
+	return n.Current(t)
+}
+
+func (n *LocalNetwork) RoundTime(round uint64) time.Time {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return time.Unix(chain.TimeOfRound(n.period, n.genesis, round), 0).Add(-n.shift).UTC()
+}
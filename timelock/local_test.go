@@ -0,0 +1,62 @@
+package timelock
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLocalNetworkSealOpen(t *testing.T) {
+	network, err := NewLocalNetwork(nil, time.Now().Add(-time.Hour), 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	round := network.RoundNumber(time.Now().Add(time.Minute))
+	ciphertext, err := Seal(network, []byte("secret"), round)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var locked *LockedError
+	if err := CheckUnlocked(network, ciphertext); !errors.As(err, &locked) {
+		t.Fatalf("Expected LockedError, got %v", err)
+	}
+	if locked.Round != round || locked.Remaining() <= 0 {
+		t.Errorf("Bad locked error %v", locked)
+	}
+	if _, err := Open(network, ciphertext); err == nil {
+		t.Fatal("Ciphertext should not be decryptable before the round")
+	}
+
+	network.Advance(20)
+	status, err := Inspect(network, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Decryptable || status.ChainHash != network.ChainHash() {
+		t.Errorf("Bad status %+v", status)
+	}
+	data, err := Open(network, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte("secret")) {
+		t.Errorf("Bad decrypted data %s", data)
+	}
+}
+
+func TestLocalNetworkSeed(t *testing.T) {
+	genesis := time.Unix(1680000000, 0)
+	n1, err := NewLocalNetwork([]byte("seed"), genesis, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n2, err := NewLocalNetwork([]byte("seed"), genesis, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n1.ChainHash() != n2.ChainHash() || !n1.PublicKey().Equal(n2.PublicKey()) {
+		t.Error("Networks with the same seed should have the same key")
+	}
+}
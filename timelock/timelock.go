@@ -0,0 +1,125 @@
+package timelock
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	nethttp "net/http"
+	"strings"
+	"time"
+
+	"github.com/drand/drand/chain"
+	"github.com/drand/drand/client"
+	dhttp "github.com/drand/drand/client/http"
+	"github.com/drand/drand/crypto"
+	"github.com/drand/kyber"
+	"github.com/drand/tlock"
+)
+
+const timeout = 5 * time.Second
+
+var ErrNotUnchained = errors.New("not an unchained network")
+
+// Drand network used for timelock encryption
+type Network interface {
+	tlock.Network
+	// Round that is available at the time
+	RoundNumber(t time.Time) uint64
+	// Time when round will be available
+	RoundTime(round uint64) time.Time
+}
+
+// Drand network accessed by http api
+type HTTPNetwork struct {
+	chainHash string
+	client    client.Client
+	publicKey kyber.Point
+	scheme    crypto.Scheme
+	period    time.Duration
+	genesis   int64
+}
+
+func NewHTTPNetwork(host, chainHash string) (*HTTPNetwork, error) {
+	if !strings.HasPrefix(host, "http") {
+		host = "https://" + host
+	}
+	hash, err := hex.DecodeString(chainHash)
+	if err != nil {
+		return nil, fmt.Errorf("decoding chain hash: %w", err)
+	}
+	cl, err := dhttp.New(host, hash, nethttp.DefaultTransport)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	info, err := cl.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sch, err := crypto.SchemeFromName(info.Scheme)
+	if err != nil || !(sch.Name == crypto.UnchainedSchemeID || sch.Name == crypto.ShortSigSchemeID) {
+		return nil, ErrNotUnchained
+	}
+	return &HTTPNetwork{
+		chainHash: chainHash,
+		client:    cl,
+		publicKey: info.PublicKey,
+		scheme:    *sch,
+		period:    info.Period,
+		genesis:   info.GenesisTime,
+	}, nil
+}
+
+func (n *HTTPNetwork) ChainHash() string {
+	return n.chainHash
+}
+
+func (n *HTTPNetwork) Current(date time.Time) uint64 {
+	return chain.CurrentRound(date.Unix(), n.period, n.genesis)
+}
+
+func (n *HTTPNetwork) PublicKey() kyber.Point {
+	return n.publicKey
+}
+
+func (n *HTTPNetwork) Scheme() crypto.Scheme {
+	return n.scheme
+}
+
+func (n *HTTPNetwork) Signature(round uint64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	result, err := n.client.Get(ctx, round)
+	if err != nil {
+		return nil, err
+	}
+	return result.Signature(), nil
+}
+
+func (n *HTTPNetwork) RoundNumber(t time.Time) uint64 {
+	return n.client.RoundAt(t)
+}
+
+func (n *HTTPNetwork) RoundTime(round uint64) time.Time {
+	return time.Unix(chain.TimeOfRound(n.period, n.genesis, round), 0).UTC()
+}
+
+// Encrypt data so it could be decrypted only after the round
+func Seal(network Network, data []byte, round uint64) ([]byte, error) {
+	var cipherData bytes.Buffer
+	if err := tlock.New(network).Encrypt(&cipherData, bytes.NewReader(data), round); err != nil {
+		return nil, err
+	}
+	return cipherData.Bytes(), nil
+}
+
+func Open(network Network, ciphertext []byte) ([]byte, error) {
+	var data bytes.Buffer
+	if err := tlock.New(network).Decrypt(&data, bytes.NewReader(ciphertext)); err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
@@ -0,0 +1,133 @@
+package usecases
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/ens"
+	"github.com/torvald2/hack-fs-2023-promise-card/pinata"
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+)
+
+var ErrUserDisabled = errors.New("user is disabled")
+
+// Filter of the admin user listing, zero values match all users
+type UserFilter struct {
+	Nick          string // case insensitive substring
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+func (f UserFilter) match(user User) bool {
+	if f.Nick != "" && !strings.Contains(strings.ToLower(user.Nick), strings.ToLower(f.Nick)) {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && !user.CreatedAt.After(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !user.CreatedAt.Before(f.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+type UserSummary struct {
+	Address   string    `json:"address"`
+	Nick      string    `json:"nick"`
+	Roles     []string  `json:"roles"`
+	Disabled  bool      `json:"disabled"`
+	UnlockAt  time.Time `json:"unlock_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// List users page by page. Filter is applied to the store page,
+// so filtered page may hold less than limit users while next cursor is not empty
+func ListUsers(store polybase.RecordStore, filter UserFilter, cursor string, limit int) (users []UserSummary, next string, err error) {
+	records, next, err := store.List(UserCollection, cursor, limit)
+	if err != nil {
+		return
+	}
+	users = make([]UserSummary, 0, len(records))
+	for _, rec := range records {
+		var user User
+		if err = fromFields(rec, &user); err != nil {
+			return
+		}
+		if !filter.match(user) {
+			continue
+		}
+		users = append(users, UserSummary{
+			Address:   user.Address,
+			Nick:      user.Nick,
+			Roles:     user.Roles,
+			Disabled:  user.Disabled,
+			UnlockAt:  user.UnlockAt,
+			CreatedAt: user.CreatedAt,
+		})
+	}
+	return
+}
+
+// User record with ENS and pin status.
+// Status lookup errors are reported in the details instead of failing the request
+type UserDetails struct {
+	User
+	ENSName      string `json:"ens_name"`
+	ENSOwner     string `json:"ens_owner"`    // root owner keeps custody of the subdomain
+	ENSAddress   string `json:"ens_address"`  // address record of the subdomain
+	ENSResolved  bool   `json:"ens_resolved"` // subdomain resolves to the user address
+	ENSError     string `json:"ens_error,omitempty"`
+	AvatarPinned bool   `json:"avatar_pinned"`
+	PinError     string `json:"pin_error,omitempty"`
+}
+
+type AdminUseCase struct {
+	store      polybase.RecordStore
+	pinataKey  string
+	ensService *ens.ENSAdaptor
+}
+
+func NewAdminUseCase(store polybase.RecordStore, pinataKey string, ensService *ens.ENSAdaptor) AdminUseCase {
+	return AdminUseCase{
+		store:      store,
+		pinataKey:  pinataKey,
+		ensService: ensService,
+	}
+}
+
+func (c *AdminUseCase) GetUser(address string) (details UserDetails, err error) {
+	details.User, err = GetUserRecord(c.store, address)
+	if err != nil {
+		return
+	}
+	details.ENSName = c.ensService.Subdomain(details.Nick)
+	if owner, ensErr := c.ensService.SubdomainOwner(details.Nick); ensErr != nil {
+		details.ENSError = ensErr.Error()
+	} else {
+		details.ENSOwner = owner
+	}
+	if address, ensErr := c.ensService.SubdomainAddress(details.Nick); ensErr != nil {
+		details.ENSError = ensErr.Error()
+	} else {
+		details.ENSAddress = address
+		details.ENSResolved = strings.EqualFold(address, details.Address)
+	}
+	if details.CID != "" {
+		if pinned, pinErr := pinata.New(c.pinataKey).IsPinned(details.CID); pinErr != nil {
+			details.PinError = pinErr.Error()
+		} else {
+			details.AvatarPinned = pinned
+		}
+	}
+	return
+}
+
+// Disabled users can't get tokens, their access tokens are refused until they expire
+func SetUserDisabled(store polybase.RecordStore, address string, disabled bool) error {
+	if _, err := GetUserRecord(store, address); err != nil {
+		return err
+	}
+	_, err := store.Update(UserCollection, address, map[string]interface{}{"disabled": disabled})
+	return err
+}
@@ -0,0 +1,73 @@
+package usecases
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+)
+
+func TestListUsers(t *testing.T) {
+	store := newTestStore(t)
+	start := time.Now().UTC()
+	for i, nick := range []string{"alice", "bob", "Alicia"} {
+		user := User{Address: string(rune('a'+i)) + "0", Nick: nick, CreatedAt: start.Add(time.Duration(i) * time.Hour)}
+		createTestUser(t, store, user)
+	}
+
+	users, next, err := ListUsers(store, UserFilter{}, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || next == "" {
+		t.Fatalf("Unexpected page %v next %q", users, next)
+	}
+	users, next, err = ListUsers(store, UserFilter{}, next, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || next != "" {
+		t.Fatalf("Unexpected page %v next %q", users, next)
+	}
+
+	users, _, err = ListUsers(store, UserFilter{Nick: "ALI", CreatedAfter: start.Add(time.Minute)}, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Nick != "Alicia" {
+		t.Fatalf("Unexpected filtered users %v", users)
+	}
+}
+
+func TestDisabledUser(t *testing.T) {
+	store := newTestStore(t, User{Address: "0xabc", Nick: "alice"})
+	keyring, err := auth.NewKeyring("", auth.AlgES256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := auth.NewIssuer("test", auth.SignWithServiceKey, keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := NewSessionUseCase(store, issuer, time.Minute, time.Hour)
+	tokens, err := sessions.Start("0xabc", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetUserDisabled(store, "0xabc", true); err != nil {
+		t.Fatal(err)
+	}
+	us := NewGetUserUseCase(store, nil, sessions, nil)
+	if _, err := us.Execute("", "0xabc", nil); !errors.Is(err, ErrUserDisabled) {
+		t.Fatalf("Expected ErrUserDisabled, got %v", err)
+	}
+	if _, err := sessions.Refresh(tokens.RefreshToken); !errors.Is(err, ErrUserDisabled) {
+		t.Fatalf("Expected ErrUserDisabled, got %v", err)
+	}
+	if err := SetUserDisabled(store, "0xdef", true); !errors.Is(err, polybase.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+}
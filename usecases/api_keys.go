@@ -0,0 +1,183 @@
+package usecases
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+	"go.uber.org/zap"
+)
+
+// API key scopes
+const (
+	ScopeCreateUser = "create-user"
+	ScopeIssueToken = "issue-token"
+	ScopeAdmin      = "admin"
+)
+
+const apiKeyPrefix = "pc"
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	ErrUnknownScope  = errors.New("unknown scope")
+)
+
+func isKnownScope(scope string) bool {
+	return scope == ScopeCreateUser || scope == ScopeIssueToken || scope == ScopeAdmin
+}
+
+// API key record. Key is pc_<id>_<secret>, only sha256 of the secret is stored
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	SecretHash string     `json:"secret_hash"`
+	Scopes     []string   `json:"scopes"`
+	UsageCount int64      `json:"usage_count"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	Version    int        `json:"version"` // store version, usage is counted with compare-and-set
+}
+
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Create new api key. The key value is returned only once
+func MintAPIKey(store polybase.RecordStore, name string, scopes []string) (key APIKey, value string, err error) {
+	if len(scopes) == 0 {
+		return key, "", ErrUnknownScope
+	}
+	for _, scope := range scopes {
+		if !isKnownScope(scope) {
+			return key, "", fmt.Errorf("%w: %s", ErrUnknownScope, scope)
+		}
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return
+	}
+	key = APIKey{
+		ID:         id,
+		Name:       name,
+		SecretHash: hashToken(secret),
+		Scopes:     scopes,
+		CreatedAt:  time.Now().UTC(),
+	}
+	fields, err := toFields(key)
+	if err != nil {
+		return
+	}
+	if _, err = store.Create(APIKeyCollection, id, fields); err != nil {
+		return
+	}
+	return key, fmt.Sprintf("%s_%s_%s", apiKeyPrefix, id, secret), nil
+}
+
+func GetAPIKey(store polybase.RecordStore, id string) (key APIKey, err error) {
+	rec, err := store.Get(APIKeyCollection, id)
+	if err != nil {
+		return
+	}
+	err = fromFields(rec, &key)
+	return
+}
+
+func ListAPIKeys(store polybase.RecordStore, cursor string, limit int) (keys []APIKey, next string, err error) {
+	records, next, err := store.List(APIKeyCollection, cursor, limit)
+	if err != nil {
+		return
+	}
+	keys = make([]APIKey, 0, len(records))
+	for _, rec := range records {
+		var key APIKey
+		if err = fromFields(rec, &key); err != nil {
+			return
+		}
+		keys = append(keys, key)
+	}
+	return
+}
+
+func RevokeAPIKey(store polybase.RecordStore, id string) error {
+	if _, err := GetAPIKey(store, id); err != nil {
+		return err
+	}
+	_, err := store.Update(APIKeyCollection, id, map[string]interface{}{"revoked_at": time.Now().UTC()})
+	return err
+}
+
+// Check api key value and count its usage.
+// Usage counter is written with compare-and-set, so it doesn't overwrite revocation of the key.
+// Counter write errors are logged and don't fail the valid key
+func AuthenticateAPIKey(store polybase.RecordStore, value string) (APIKey, error) {
+	parts := strings.Split(value, "_")
+	if len(parts) != 3 || parts[0] != apiKeyPrefix {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	key, err := GetAPIKey(store, parts[1])
+	if errors.Is(err, polybase.ErrNotFound) {
+		return key, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return key, err
+	}
+	if key.RevokedAt != nil || subtle.ConstantTimeCompare([]byte(hashToken(parts[2])), []byte(key.SecretHash)) != 1 {
+		return key, ErrInvalidAPIKey
+	}
+	for i := 0; i < usageAttempts; i++ {
+		err = countUsage(store, &key)
+		if !errors.Is(err, polybase.ErrVersionConflict) {
+			break
+		}
+		// Key is changed concurrently, it may be revoked
+		current, getErr := GetAPIKey(store, key.ID)
+		if getErr != nil {
+			err = getErr
+			break
+		}
+		if current.RevokedAt != nil {
+			return current, ErrInvalidAPIKey
+		}
+		key = current
+	}
+	if err != nil {
+		zap.L().Warn("Count api key usage error", zap.String("key", key.ID), zap.Error(err))
+	}
+	return key, nil
+}
+
+// Attempts to count the key usage when the key is changed concurrently
+const usageAttempts = 5
+
+func countUsage(store polybase.RecordStore, key *APIKey) error {
+	now := time.Now().UTC()
+	fields := map[string]interface{}{"usage_count": key.UsageCount + 1, "last_used_at": now}
+	rec, err := store.UpdateVersion(APIKeyCollection, key.ID, key.Version, fields)
+	if err != nil {
+		return err
+	}
+	return fromFields(rec, key)
+}
+
+func randomHex(n int) (string, error) {
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
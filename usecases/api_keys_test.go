@@ -0,0 +1,91 @@
+package usecases
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+)
+
+func TestAPIKeys(t *testing.T) {
+	store := newTestStore(t)
+
+	if _, _, err := MintAPIKey(store, "frontend", []string{"root"}); !errors.Is(err, ErrUnknownScope) {
+		t.Fatalf("Expected ErrUnknownScope, got %v", err)
+	}
+	key, value, err := MintAPIKey(store, "frontend", []string{ScopeCreateUser, ScopeIssueToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(key.SecretHash, strings.Split(value, "_")[2]) {
+		t.Fatal("Secret must not be stored")
+	}
+
+	for i := 0; i < 2; i++ {
+		authenticated, err := AuthenticateAPIKey(store, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !authenticated.HasScope(ScopeCreateUser) || authenticated.HasScope(ScopeAdmin) {
+			t.Fatalf("Unexpected scopes %v", authenticated.Scopes)
+		}
+	}
+	key, err = GetAPIKey(store, key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.UsageCount != 2 || key.LastUsedAt == nil {
+		t.Fatalf("Unexpected usage %v %v", key.UsageCount, key.LastUsedAt)
+	}
+
+	if _, err := AuthenticateAPIKey(store, value+"x"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("Expected ErrInvalidAPIKey, got %v", err)
+	}
+	if err := RevokeAPIKey(store, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AuthenticateAPIKey(store, value); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("Expected ErrInvalidAPIKey for revoked key, got %v", err)
+	}
+}
+
+// Store that runs the hook before every compare-and-set update
+type hookStore struct {
+	*polybase.BoltStore
+	beforeUpdate func() error
+}
+
+func (s hookStore) UpdateVersion(collection, id string, version int, fields map[string]interface{}) (map[string]interface{}, error) {
+	if err := s.beforeUpdate(); err != nil {
+		return nil, err
+	}
+	return s.BoltStore.UpdateVersion(collection, id, version, fields)
+}
+
+func TestAPIKeyUsageCounter(t *testing.T) {
+	bolt := newTestStore(t)
+	key, value, err := MintAPIKey(bolt, "frontend", []string{ScopeIssueToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Failed counter write doesn't fail the valid key
+	failing := hookStore{bolt, func() error { return errors.New("store unavailable") }}
+	if _, err := AuthenticateAPIKey(failing, value); err != nil {
+		t.Fatalf("Expected valid key, got %v", err)
+	}
+
+	// Key revoked after it was read is not restored by the counter write
+	revoking := hookStore{bolt, func() error { return RevokeAPIKey(bolt, key.ID) }}
+	if _, err := AuthenticateAPIKey(revoking, value); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("Expected ErrInvalidAPIKey for revoked key, got %v", err)
+	}
+	key, err = GetAPIKey(bolt, key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.RevokedAt == nil || key.UsageCount != 0 {
+		t.Errorf("Unexpected key %+v", key)
+	}
+}
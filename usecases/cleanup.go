@@ -0,0 +1,81 @@
+package usecases
+
+import (
+	"errors"
+	"time"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+)
+
+// Delete expired or used authorization codes and expired or revoked sessions.
+// Both are refused by the token endpoints already, deleting them keeps the collections small
+func CollectExpired(store polybase.RecordStore, now time.Time) (deleted int, err error) {
+	codes, err := collect(store, AuthCodeCollection, func(rec map[string]interface{}) (bool, error) {
+		var code AuthCode
+		if err := fromFields(rec, &code); err != nil {
+			return false, err
+		}
+		return code.Used || now.After(code.ExpiresAt), nil
+	})
+	if err != nil {
+		return codes, err
+	}
+	sessions, err := collect(store, SessionCollection, func(rec map[string]interface{}) (bool, error) {
+		var session Session
+		if err := fromFields(rec, &session); err != nil {
+			return false, err
+		}
+		return session.Revoked || now.After(session.ExpiresAt), nil
+	})
+	return codes + sessions, err
+}
+
+// Collect expired records every period until done channel is closed
+func AutoCollectExpired(store polybase.RecordStore, period time.Duration, done <-chan struct{}, onError func(error)) {
+	if period <= 0 {
+		return
+	}
+	ticker := time.NewTicker(period)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if _, err := CollectExpired(store, now); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+// Delete records of the collection matched by expired
+func collect(store polybase.RecordStore, collection string, expired func(rec map[string]interface{}) (bool, error)) (deleted int, err error) {
+	cursor := ""
+	for {
+		records, next, err := store.List(collection, cursor, 100)
+		if err != nil {
+			return deleted, err
+		}
+		for _, rec := range records {
+			ok, err := expired(rec)
+			if err != nil {
+				return deleted, err
+			}
+			if !ok {
+				continue
+			}
+			id, _ := rec["id"].(string)
+			if err := store.Delete(collection, id); err != nil && !errors.Is(err, polybase.ErrNotFound) {
+				return deleted, err
+			}
+			deleted++
+		}
+		if next == "" {
+			return deleted, nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,50 @@
+package usecases
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCollectExpired(t *testing.T) {
+	store := newTestStore(t)
+	now := time.Now()
+	for id, code := range map[string]AuthCode{
+		"valid":   {ExpiresAt: now.Add(time.Minute)},
+		"expired": {ExpiresAt: now.Add(-time.Minute)},
+		"used":    {ExpiresAt: now.Add(time.Minute), Used: true},
+	} {
+		code.ID = id
+		fields, _ := toFields(code)
+		if _, err := store.Create(AuthCodeCollection, id, fields); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id, session := range map[string]Session{
+		"valid":   {ExpiresAt: now.Add(time.Hour)},
+		"expired": {ExpiresAt: now.Add(-time.Hour)},
+		"revoked": {ExpiresAt: now.Add(time.Hour), Revoked: true},
+	} {
+		session.ID = id
+		fields, _ := toFields(session)
+		if _, err := store.Create(SessionCollection, id, fields); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := CollectExpired(store, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 4 {
+		t.Fatalf("Expected 4 deleted records, got %d", deleted)
+	}
+	for _, collection := range []string{AuthCodeCollection, SessionCollection} {
+		records, _, err := store.List(collection, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 || records[0]["id"] != "valid" {
+			t.Fatalf("Unexpected %s records %v", collection, records)
+		}
+	}
+}
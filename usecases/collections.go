@@ -0,0 +1,13 @@
+package usecases
+
+// Record store collections
+const (
+	UserCollection           = "User"
+	JobCollection            = "Job"
+	ReconciliationCollection = "Reconciliation"
+	SessionCollection        = "Session"
+	OAuthClientCollection    = "OAuthClient"
+	AuthCodeCollection       = "AuthCode"
+	APIKeyCollection         = "APIKey"
+	NickCollection           = "Nick"
+)
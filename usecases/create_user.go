@@ -1,90 +1,254 @@
 package usecases
 
 import (
-	"bytes"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"time"
 
-	"github.com/drand/tlock"
-	"github.com/drand/tlock/networks/http"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
 	"github.com/torvald2/hack-fs-2023-promise-card/ens"
 	"github.com/torvald2/hack-fs-2023-promise-card/pinata"
 	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
 	"github.com/torvald2/hack-fs-2023-promise-card/storage"
+	"github.com/torvald2/hack-fs-2023-promise-card/timelock"
+	"go.uber.org/zap"
+)
+
+// User provisioning steps in execution order
+const (
+	StepAccount   = "account"
+	StepRecord    = "record"
+	StepPin       = "pin"
+	StepSubdomain = "subdomain"
+	StepAvatar    = "avatar"
+	StepReverse   = "reverse"
+	StepHandover  = "handover"
 )
 
 type CreateUserUseCase struct {
-	key               string
-	url               string
-	namespace         string
-	timelockHost      string
-	timelockChainHash string
-	encryptedKey      []byte
-	address           string
-	pinataKey         string
-	ensRootOwner      string
-	ensPrivateKey     string
-	mainENS           string
-	rpcUrl            string
-	resolver          string
-}
-
-func NewCreateUserUseCase(key string, url string, namespace string, tlUrl, tlCHash, pinataKey, ensRootOwner, ensPrivateKey, mainENS, rpcURL, resolver string) CreateUserUseCase {
+	store      polybase.RecordStore
+	network    timelock.Network
+	pinataKey  string
+	ensService *ens.ENSAdaptor
+}
+
+// Provisioning step with optional compensating action.
+// Compensation must be safe to run for partially done step.
+// Failed optional step keeps its error and the job continues
+type provisionStep struct {
+	name       string
+	run        func(job *ProvisionJob) error
+	action     string
+	compensate func(job *ProvisionJob) error
+	optional   bool
+}
+
+func NewCreateUserUseCase(store polybase.RecordStore, network timelock.Network, pinataKey string, ensService *ens.ENSAdaptor) CreateUserUseCase {
 	return CreateUserUseCase{
-		key:               key,
-		url:               url,
-		namespace:         namespace,
-		timelockHost:      tlUrl,
-		timelockChainHash: tlCHash,
-		ensRootOwner:      ensRootOwner,
-		ensPrivateKey:     ensPrivateKey,
-		mainENS:           mainENS,
-		rpcUrl:            rpcURL,
-		resolver:          resolver,
-		pinataKey:         pinataKey,
+		store:      store,
+		network:    network,
+		ensService: ensService,
+		pinataKey:  pinataKey,
 	}
 
 }
 
-func (c *CreateUserUseCase) Execute(nickName string, duration time.Duration, avatar string) error {
+// Subdomain is handed over to the card address after its records are set,
+// unless the root owner keeps custody of subdomains.
+// ENS steps save the job after every sent transaction, so a resumed step doesn't send it again
+func (c *CreateUserUseCase) steps(save func(*ProvisionJob) error) []provisionStep {
+	ensStep := func(step func(job *ProvisionJob, save func(*ProvisionJob) error) error) func(job *ProvisionJob) error {
+		return func(job *ProvisionJob) error {
+			return step(job, save)
+		}
+	}
+	steps := []provisionStep{
+		{StepAccount, c.createAccount, "", nil, false},
+		{StepRecord, c.createRecord, "delete user record", c.deleteRecord, false},
+		{StepPin, c.pinAvatar, "unpin avatar", c.unpinAvatar, false},
+		{StepSubdomain, ensStep(c.createSubdomain), "release subdomain to root owner", ensStep(c.releaseSubdomain), false},
+		{StepAvatar, ensStep(c.createAvatar), "", nil, false},
+		{StepReverse, ensStep(c.setReverseName), "", nil, true},
+	}
+	if c.ensService != nil && !c.ensService.KeepCustody {
+		steps = append(steps, provisionStep{StepHandover, ensStep(c.handOverSubdomain), "", nil, false})
+	}
+	return steps
+}
+
+// Journal of the job transactions that saves the job after every sent transaction
+func jobJournal(job *ProvisionJob, txs *[]ens.TxRecord, save func(*ProvisionJob) error) *ens.Journal {
+	return &ens.Journal{
+		Txs: *txs,
+		Sent: func(sent []ens.TxRecord) error {
+			*txs = sent
+			return save(job)
+		},
+	}
+}
+
+// Run provisioning steps that are not done yet.
+// Job is saved after every step so the interrupted job continues from the failed step.
+// When a step fails all started steps are compensated in reverse order
+func (c *CreateUserUseCase) Execute(job *ProvisionJob, save func(*ProvisionJob) error) error {
+	if job.Status == JobCompensating {
+		return c.compensate(job, save)
+	}
+	job.Status = JobRunning
+	if err := save(job); err != nil {
+		return err
+	}
+	for _, step := range c.steps(save) {
+		state := job.step(step.name)
+		if state.Status == StepStatusDone {
+			continue
+		}
+		err := step.run(job)
+		if err != nil && step.optional {
+			zap.L().Error("Optional provisioning step failed", zap.String("job", job.ID), zap.String("step", step.name), zap.Error(err))
+			state.Status = StepStatusFailed
+			state.Error = err.Error()
+			if err := save(job); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			state.Status = StepStatusFailed
+			state.Error = err.Error()
+			job.Status = JobCompensating
+			job.Error = err.Error()
+			if saveErr := save(job); saveErr != nil {
+				return saveErr
+			}
+			if compErr := c.compensate(job, save); compErr != nil {
+				return compErr
+			}
+			return err
+		}
+		state.Status = StepStatusDone
+		if err := save(job); err != nil {
+			return err
+		}
+	}
+	job.Status = JobDone
+	return save(job)
+}
+
+func (c *CreateUserUseCase) compensate(job *ProvisionJob, save func(*ProvisionJob) error) error {
+	steps := c.steps(save)
+	status := JobRolledBack
+	for i := len(steps) - 1; i >= 0; i-- {
+		step := steps[i]
+		state := job.step(step.name)
+		if step.compensate == nil || (state.Status != StepStatusDone && state.Status != StepStatusFailed) {
+			continue
+		}
+		entry := ReconciliationEntry{
+			JobID:   job.ID,
+			Address: job.Address,
+			Nick:    job.Nick,
+			Step:    step.name,
+			Action:  step.action,
+			Status:  ReconciliationDone,
+		}
+		if err := step.compensate(job); err != nil {
+			entry.Status = ReconciliationFailed
+			entry.Error = err.Error()
+			status = JobRollbackFailed
+		} else {
+			state.Status = StepStatusCompensated
+		}
+		if err := saveReconciliation(c.store, entry); err != nil {
+			return err
+		}
+		if err := save(job); err != nil {
+			return err
+		}
+	}
+	// Nick of the rolled back card is free again, it stays reserved while the rollback is not finished
+	if status == JobRolledBack {
+		if err := releaseNick(c.store, job.Nick, job.ID); err != nil {
+			return err
+		}
+	}
+	job.Status = status
+	return save(job)
+}
+
+// Generate account key and encrypt it with timelock or split it into shares.
+// Private key is never saved so the step is done in one go
+func (c *CreateUserUseCase) createAccount(job *ProvisionJob) error {
 	usr := storage.Account{
-		NickName: nickName,
+		NickName: job.Nick,
+		Roles:    []string{auth.RoleUser},
 	}
 	privateKey, err := usr.CreateAddress()
 	if err != nil {
 		return err
 	}
-	cl, err := polybase.NewPolybaseClient(c.namespace, c.url)
-	if err != nil {
+	job.Address = usr.PublicKey
+	job.Roles = usr.Roles
+	if job.Shamir != nil {
+		keyBytes, err := hexutil.Decode(privateKey)
+		if err != nil {
+			return err
+		}
+		job.KeyShares, job.GuardianShares, err = splitKey(c.network, keyBytes, *job.Shamir)
 		return err
 	}
-	args := make([]interface{}, 0)
-	args = append(args, usr.PublicKey)
-	args = append(args, nickName)
-	_, err = cl.CreateRecord("User", args, c.key)
+	roundNumber := c.network.RoundNumber(time.Now().Add(job.Duration))
+	data, err := timelock.Seal(c.network, []byte(privateKey), roundNumber)
 	if err != nil {
 		return err
 	}
-	network, err := http.NewNetwork(c.timelockHost, c.timelockChainHash)
+	job.EncryptedKey = hex.EncodeToString(data)
+	job.Round = roundNumber
+	job.UnlockAt = c.network.RoundTime(roundNumber)
+	return nil
+}
+
+func (c *CreateUserUseCase) createRecord(job *ProvisionJob) error {
+	// Fresh slice, appending to the job schedule could write into its backing array
+	schedule := make([]ScheduledPayload, 0, len(job.Schedule)+len(job.KeyShares))
+	schedule = append(append(schedule, job.Schedule...), job.KeyShares...)
+	user := User{
+		Address:   job.Address,
+		Nick:      job.Nick,
+		SealedKey: job.EncryptedKey,
+		Round:     job.Round,
+		UnlockAt:  job.UnlockAt,
+		Schedule:  schedule,
+		Roles:     job.Roles,
+		CreatedAt: time.Now().UTC(),
+	}
+	if job.Shamir != nil {
+		user.ShareThreshold = job.Shamir.Threshold
+		user.GuardianShares = job.GuardianShares
+	}
+	fields, err := toFields(user)
 	if err != nil {
 		return err
 	}
-	roundNumber := network.RoundNumber(time.Now().Add(duration))
-	var cipherData bytes.Buffer
+	_, err = c.store.Create(UserCollection, job.Address, fields)
+	return err
+}
 
-	if err := tlock.New(network).Encrypt(&cipherData, bytes.NewBuffer([]byte(privateKey)), roundNumber); err != nil {
-		return err
+func (c *CreateUserUseCase) deleteRecord(job *ProvisionJob) error {
+	err := c.store.Delete(UserCollection, job.Address)
+	if errors.Is(err, polybase.ErrNotFound) {
+		return nil
 	}
-	data, _ := ioutil.ReadAll(&cipherData)
-	c.encryptedKey = data
-	c.address = usr.PublicKey
+	return err
+}
 
+func (c *CreateUserUseCase) pinAvatar(job *ProvisionJob) error {
 	pinataService := pinata.New(c.pinataKey)
 
-	image, err := base64.StdEncoding.DecodeString(avatar)
+	image, err := base64.StdEncoding.DecodeString(job.Avatar)
 	if err != nil {
 		return err
 	}
@@ -92,30 +256,53 @@ func (c *CreateUserUseCase) Execute(nickName string, duration time.Duration, ava
 	if err != nil {
 		return err
 	}
+	job.CID = cid
+	job.Avatar = ""
+	_, err = c.store.Update(UserCollection, job.Address, map[string]interface{}{"cid": cid})
+	return err
+}
 
-	ensService := ens.ENSAdaptor{
-		OwnerAddress:    c.ensRootOwner,
-		PrivateKey:      c.ensPrivateKey,
-		MainDomain:      c.mainENS,
-		RPCUrl:          c.rpcUrl,
-		ResolverAddress: c.resolver,
+func (c *CreateUserUseCase) unpinAvatar(job *ProvisionJob) error {
+	if job.CID == "" {
+		return nil
 	}
+	return pinata.New(c.pinataKey).Unpin(job.CID)
+}
 
-	_, err = ensService.CreateSubdomain(nickName, c.address)
-	if err != nil {
-		return err
+func (c *CreateUserUseCase) createSubdomain(job *ProvisionJob, save func(*ProvisionJob) error) (err error) {
+	job.SubdomainTx, err = c.ensService.CreateSubdomain(job.Nick, job.Address, jobJournal(job, &job.SubdomainTx, save))
+	return
+}
+
+// Nothing to release when no transaction was sent, e.g. the name is taken by another address
+func (c *CreateUserUseCase) releaseSubdomain(job *ProvisionJob, save func(*ProvisionJob) error) (err error) {
+	if len(job.SubdomainTx) == 0 {
+		return nil
 	}
-	_, err = ensService.CreateAvatar(fmt.Sprintf("ipfs://%s", cid), nickName)
-	if err != nil {
-		return err
+	job.ReleaseTx, err = c.ensService.ReleaseSubdomain(job.Nick, jobJournal(job, &job.ReleaseTx, save))
+	return
+}
+
+func (c *CreateUserUseCase) createAvatar(job *ProvisionJob, save func(*ProvisionJob) error) (err error) {
+	job.AvatarTx, err = c.ensService.CreateAvatar(fmt.Sprintf("ipfs://%s", job.CID), job.Nick, jobJournal(job, &job.AvatarTx, save))
+	return
+}
+
+// Set reverse record of the card address to the subdomain when reverse records are enabled.
+// Reverse record is optional, its failure is kept in the step and does not roll back the card
+func (c *CreateUserUseCase) setReverseName(job *ProvisionJob, save func(*ProvisionJob) error) (err error) {
+	if !c.reverseRecords() {
+		return nil
 	}
-	return nil
+	job.ReverseTx, err = c.ensService.SetReverseName(job.Address, c.ensService.Subdomain(job.Nick), jobJournal(job, &job.ReverseTx, save))
+	return
 }
 
-func (c *CreateUserUseCase) GetPrivateKey() string {
-	return hex.EncodeToString(c.encryptedKey)
+func (c *CreateUserUseCase) handOverSubdomain(job *ProvisionJob, save func(*ProvisionJob) error) (err error) {
+	job.HandoverTx, err = c.ensService.HandOverSubdomain(job.Nick, job.Address, jobJournal(job, &job.HandoverTx, save))
+	return
 }
 
-func (c *CreateUserUseCase) GetAddress() string {
-	return c.address
+func (c *CreateUserUseCase) reverseRecords() bool {
+	return c.ensService != nil && c.ensService.ReverseRecords
 }
@@ -0,0 +1,164 @@
+package usecases
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/torvald2/hack-fs-2023-promise-card/timelock"
+)
+
+func TestSealAndUnlockAccount(t *testing.T) {
+	store := newTestStore(t)
+	network, err := timelock.NewLocalNetwork(nil, time.Now().Add(-time.Hour), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	us := NewCreateUserUseCase(store, network, "", nil)
+	job := ProvisionJob{ID: "1", Nick: "alice", Duration: time.Hour}
+	if err := us.createAccount(&job); err != nil {
+		t.Fatal(err)
+	}
+	if err := us.createRecord(&job); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := GetSealedKey(store, job.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed.PrivateKeyEncrypted != job.EncryptedKey || sealed.Round != job.Round {
+		t.Fatalf("Bad sealed key %+v", sealed)
+	}
+
+	status := NewUnlockStatusUseCase(network)
+	st, err := status.Execute(sealed.PrivateKeyEncrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Decryptable {
+		t.Fatal("Key should be locked")
+	}
+
+	network.Advance(uint64(time.Hour / time.Second))
+	st, err = status.Execute(sealed.PrivateKeyEncrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Decryptable {
+		t.Fatal("Key should be unlocked")
+	}
+	ciphertext, _ := hex.DecodeString(sealed.PrivateKeyEncrypted)
+	key, err := timelock.Open(network, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := crypto.HexToECDSA(string(key[2:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crypto.PubkeyToAddress(privateKey.PublicKey).Hex() != job.Address {
+		t.Error("Unlocked key doesn't match the address")
+	}
+}
+
+func TestGetJobMigratesLegacyTxs(t *testing.T) {
+	store := newTestStore(t)
+	if _, err := store.Create(JobCollection, "1", map[string]interface{}{
+		"id":           "1",
+		"status":       JobDone,
+		"subdomain_tx": "0x01",
+		"avatar_tx":    "0x02",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := GetJob(store, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(job.SubdomainTx) != 1 || job.SubdomainTx[0].Hash != "0x01" || len(job.AvatarTx) != 1 || job.AvatarTx[0].Hash != "0x02" {
+		t.Fatalf("Legacy hashes not migrated %+v", job)
+	}
+	if len(job.ReleaseTx) != 0 || job.LegacySubdomainTx != "" || job.LegacyAvatarTx != "" {
+		t.Fatalf("Unexpected tx fields %+v", job)
+	}
+}
+
+func TestProvisionerQueueOverflow(t *testing.T) {
+	store := newTestStore(t)
+	p := NewProvisioner(store, NewCreateUserUseCase(store, nil, "", nil))
+	jobs := cap(p.queue) + 1
+	for i := 0; i < jobs; i++ {
+		id := fmt.Sprintf("%03d", i)
+		if _, err := store.Create(JobCollection, id, map[string]interface{}{"id": id, "status": JobQueued}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Full queue doesn't block, the last job waits in the store
+	if err := p.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.queue) != jobs-1 {
+		t.Fatalf("Expected %d queued jobs, got %d", jobs-1, len(p.queue))
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < jobs-1; i++ {
+		id := <-p.queue
+		seen[id] = true
+		if _, err := store.Update(JobCollection, id, map[string]interface{}{"status": JobDone}); err != nil {
+			t.Fatal(err)
+		}
+		p.done(id)
+	}
+	select {
+	case id := <-p.queue:
+		if seen[id] {
+			t.Fatalf("Job %s queued twice", id)
+		}
+	default:
+		t.Fatal("Job left in the store is not resumed")
+	}
+}
+
+func TestProvisionerStop(t *testing.T) {
+	store := newTestStore(t)
+	p := NewProvisioner(store, NewCreateUserUseCase(store, nil, "", nil))
+	p.Start(2)
+
+	// Running job holds its worker past the deadline
+	p.workers.Add(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected DeadlineExceeded, got %v", err)
+	}
+	p.workers.Done()
+}
+
+func TestCreateRecordKeepsJobSchedule(t *testing.T) {
+	store := newTestStore(t)
+	us := NewCreateUserUseCase(store, nil, "", nil)
+	schedule := make([]ScheduledPayload, 1, 2)
+	schedule[0].Label = "letter"
+	job := ProvisionJob{ID: "1", Address: "0xabc", Schedule: schedule, KeyShares: []ScheduledPayload{{Label: "share", Share: true}}}
+	if err := us.createRecord(&job); err != nil {
+		t.Fatal(err)
+	}
+	if spare := job.Schedule[:2][1]; spare.Label != "" {
+		t.Fatalf("Job schedule backing array is overwritten with %+v", spare)
+	}
+	user, err := GetUserRecord(store, "0xabc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(user.Schedule) != 2 || user.Schedule[1].Label != "share" {
+		t.Fatalf("Unexpected user schedule %+v", user.Schedule)
+	}
+}
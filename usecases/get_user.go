@@ -1,65 +1,50 @@
 package usecases
 
 import (
-	"bytes"
+	"crypto/ecdsa"
 	"encoding/hex"
 	"fmt"
-	"io/ioutil"
 	"time"
 
-	"github.com/drand/tlock"
-	"github.com/drand/tlock/networks/http"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/golang-jwt/jwt"
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
 	"github.com/torvald2/hack-fs-2023-promise-card/ens"
 	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+	"github.com/torvald2/hack-fs-2023-promise-card/timelock"
+	"go.uber.org/zap"
 )
 
 type GetUserUseCase struct {
-	timelockHost      string
-	timelockChainHash string
-	key               string
-	url               string
-	namespace         string
-	ensRootOwner      string
-	ensPrivateKey     string
-	mainENS           string
-	rpcUrl            string
-	resolver          string
+	network    timelock.Network
+	sessions   *SessionUseCase
+	store      polybase.RecordStore
+	ensService *ens.ENSAdaptor
 }
 
-func NewGetUserUseCase(key string, url string, namespace string, tlUrl, tlCHash, pinataKey, ensRootOwner, ensPrivateKey, mainENS, rpcURL, resolver string) GetUserUseCase {
+func NewGetUserUseCase(store polybase.RecordStore, network timelock.Network, sessions *SessionUseCase, ensService *ens.ENSAdaptor) GetUserUseCase {
 	return GetUserUseCase{
-		key:               key,
-		url:               url,
-		namespace:         namespace,
-		timelockHost:      tlUrl,
-		timelockChainHash: tlCHash,
-		ensRootOwner:      ensRootOwner,
-		ensPrivateKey:     ensPrivateKey,
-		mainENS:           mainENS,
-		rpcUrl:            rpcURL,
-		resolver:          resolver,
+		store:      store,
+		network:    network,
+		sessions:   sessions,
+		ensService: ensService,
 	}
 
 }
 
-func (c *GetUserUseCase) Execute(key, address string) (token string, err error) {
-	network, err := http.NewNetwork(c.timelockHost, c.timelockChainHash)
+// Decrypt user key and start session with access and refresh tokens.
+// When key is empty the sealed key stored in user record is used.
+// Keys split into Shamir shares are restored from the supplied and unlocked timelock shares
+func (c *GetUserUseCase) Execute(key, address string, shares []string) (tokens TokenPair, err error) {
+	user, err := GetUserRecord(c.store, address)
 	if err != nil {
 		return
 	}
-	keyBytes, err := hex.DecodeString(key)
-	if err != nil {
+	if user.Disabled {
+		err = ErrUserDisabled
 		return
 	}
-	var data bytes.Buffer
-
-	if err := tlock.New(network).Decrypt(&data, bytes.NewBuffer(keyBytes)); err != nil {
-		return "", err
-	}
-	keyEncrypted, _ := ioutil.ReadAll(&data)
-	usersKey, err := crypto.HexToECDSA(string(keyEncrypted[2:]))
+	usersKey, err := c.unsealKey(user, key, shares)
 	if err != nil {
 		return
 	}
@@ -70,45 +55,85 @@ func (c *GetUserUseCase) Execute(key, address string) (token string, err error)
 		return
 	}
 
-	cl, err := polybase.NewPolybaseClient(c.namespace, c.url)
+	userData, err := c.userData(user)
 	if err != nil {
 		return
 	}
-	userData, err := cl.GetRecord("User", c.key, address)
+	return c.sessions.Start(address, userData, usersKey)
+}
+
+// Exchange the card token signed with the card key for the service tokens.
+// The card must exist, the token data is not trusted and is read from the user record
+func (c *GetUserUseCase) ExchangeCardToken(address string) (tokens TokenPair, err error) {
+	user, err := GetUserRecord(c.store, address)
 	if err != nil {
 		return
 	}
-	ensService := ens.ENSAdaptor{
-		OwnerAddress:    c.ensRootOwner,
-		PrivateKey:      c.ensPrivateKey,
-		MainDomain:      c.mainENS,
-		RPCUrl:          c.rpcUrl,
-		ResolverAddress: c.resolver,
+	if user.Disabled {
+		err = ErrUserDisabled
+		return
 	}
-	avatar, err := ensService.ResolveAvatar(address)
+	userData, err := c.userData(user)
 	if err != nil {
 		return
 	}
-	userData["avatar"] = avatar
-	privateKeyBytes := crypto.FromECDSA(usersKey)
+	return c.sessions.Start(user.Address, userData, nil)
+}
 
-	accessToken, err := CreateAccessToken(10*time.Minute, userData, privateKeyBytes, "promisecards")
+// Signature proves key possession, sealed key must be unlocked anyway
+func (c *GetUserUseCase) checkUnlocked(user User) error {
+	if user.SealedKey == "" {
+		return nil
+	}
+	sealed, err := hex.DecodeString(user.SealedKey)
 	if err != nil {
-		return
+		return err
 	}
-
-	return accessToken, nil
+	return timelock.CheckUnlocked(c.network, sealed)
 }
 
-func CreateAccessToken(ttl time.Duration, content interface{}, k []byte, iis string) (token string, err error) {
-
-	key, err := crypto.ToECDSA(k)
+// Token data of the user
+func (c *GetUserUseCase) userData(user User) (map[string]interface{}, error) {
+	// Subdomain may be not registered yet while the user is provisioned
+	avatar, err := c.ensService.ResolveAvatar(user.Nick)
+	if err != nil {
+		zap.L().Warn("Resolve avatar error", zap.String("nick", user.Nick), zap.Error(err))
+	}
+	return map[string]interface{}{
+		"id":     user.Address,
+		"nick":   user.Nick,
+		"avatar": avatar,
+	}, nil
+}
 
-	//key, err := jwt.ParseECPrivateKeyFromPEM(k)
+func (c *GetUserUseCase) unsealKey(user User, key string, shares []string) (*ecdsa.PrivateKey, error) {
+	if user.ShareThreshold > 0 {
+		keyBytes, err := combineKey(c.network, user, shares)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.ToECDSA(keyBytes)
+	}
+	if key == "" {
+		key = user.SealedKey
+	}
+	keyBytes, err := hex.DecodeString(key)
 	if err != nil {
-		return
+		return nil, err
+	}
+	if err := timelock.CheckUnlocked(c.network, keyBytes); err != nil {
+		return nil, err
 	}
+	keyEncrypted, err := timelock.Open(c.network, keyBytes)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.HexToECDSA(string(keyEncrypted[2:]))
+}
 
+// Create access token of the user with address subject.
+// Nil key signs the token with the service key
+func CreateAccessToken(issuer *auth.Issuer, ttl time.Duration, subject string, content interface{}, roles []string, key *ecdsa.PrivateKey) (token string, err error) {
 	now := time.Now().UTC()
 
 	claims := make(jwt.MapClaims)
@@ -116,8 +141,11 @@ func CreateAccessToken(ttl time.Duration, content interface{}, k []byte, iis str
 	claims["exp"] = now.Add(ttl).Unix() // The expiration time after which the token must be disregarded.
 	claims["iat"] = now.Unix()          // The time at which the token was issued.
 	claims["nbf"] = now.Unix()          // The time before which the token must be disregarded.
-	claims["iis"] = iis
+	claims["iss"] = issuer.Name
+	claims["sub"] = subject
+	claims["aud"] = issuer.Name
+	claims["token_use"] = auth.TokenUseAccess
+	claims["roles"] = roles
 
-	token, err = jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(key)
-	return
+	return issuer.Sign(claims, key)
 }
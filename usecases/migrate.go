@@ -0,0 +1,35 @@
+package usecases
+
+import (
+	"errors"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+)
+
+// Copy user records to the store with the current schema, users already present in the store are kept.
+// Returns the number of copied users
+func MigrateUsers(from, to polybase.RecordStore) (int, error) {
+	copied := 0
+	cursor := ""
+	for {
+		records, next, err := from.List(UserCollection, cursor, 100)
+		if err != nil {
+			return copied, err
+		}
+		for _, rec := range records {
+			id, _ := rec["id"].(string)
+			_, err := to.Create(UserCollection, id, rec)
+			if errors.Is(err, polybase.ErrAlreadyExists) {
+				continue
+			}
+			if err != nil {
+				return copied, err
+			}
+			copied++
+		}
+		if next == "" {
+			return copied, nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,24 @@
+package usecases
+
+import "testing"
+
+func TestMigrateUsers(t *testing.T) {
+	from := newTestStore(t, User{Address: "0x1", Nick: "alice"}, User{Address: "0x2", Nick: "bob"})
+	to := newTestStore(t, User{Address: "0x2", Nick: "bob", Roles: []string{"admin"}})
+
+	copied, err := MigrateUsers(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied != 1 {
+		t.Errorf("Expected 1 copied user, got %d", copied)
+	}
+	user, err := GetUserRecord(to, "0x1")
+	if err != nil || user.Nick != "alice" {
+		t.Errorf("Bad migrated user %v %v", user, err)
+	}
+	user, err = GetUserRecord(to, "0x2")
+	if err != nil || len(user.Roles) != 1 {
+		t.Errorf("Existing user is replaced %v %v", user, err)
+	}
+}
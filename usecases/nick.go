@@ -0,0 +1,75 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/ens"
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+)
+
+// Nick reserved by the provisioning job, the record id is the normalized nick.
+// Reservation is removed when the job is rolled back
+type NickReservation struct {
+	JobID     string    `json:"job_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Normalized nick that is free on chain and not reserved by a job.
+// Returns ens.ErrBadLabel for invalid nick and ens.ErrNameTaken for taken one
+func CheckNick(store polybase.RecordStore, ensService *ens.ENSAdaptor, nick string) (string, error) {
+	normalized, err := ens.NormalizeLabel(nick)
+	if err != nil {
+		return "", err
+	}
+	available, err := ensService.SubdomainAvailable(normalized)
+	if err != nil {
+		return "", err
+	}
+	if available {
+		_, err = store.Get(NickCollection, normalized)
+		if err == nil {
+			available = false
+		} else if !errors.Is(err, polybase.ErrNotFound) {
+			return "", err
+		}
+	}
+	if !available {
+		return "", fmt.Errorf("%w: %s", ens.ErrNameTaken, ensService.Subdomain(normalized))
+	}
+	return normalized, nil
+}
+
+// Reserve nick for the job. The store refuses the second record of the nick,
+// so only one of concurrent requests gets it
+func reserveNick(store polybase.RecordStore, nick, jobID string) error {
+	fields, err := toFields(NickReservation{JobID: jobID, CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	_, err = store.Create(NickCollection, nick, fields)
+	if errors.Is(err, polybase.ErrAlreadyExists) {
+		return fmt.Errorf("%w: %s", ens.ErrNameTaken, nick)
+	}
+	return err
+}
+
+// Remove reservation of the job, reservations of other jobs are kept
+func releaseNick(store polybase.RecordStore, nick, jobID string) error {
+	rec, err := store.Get(NickCollection, nick)
+	if errors.Is(err, polybase.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var reservation NickReservation
+	if err := fromFields(rec, &reservation); err != nil {
+		return err
+	}
+	if reservation.JobID != jobID {
+		return nil
+	}
+	return store.Delete(NickCollection, nick)
+}
@@ -0,0 +1,58 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/ens"
+)
+
+func TestCheckNick(t *testing.T) {
+	store := newTestStore(t)
+
+	ensService := ens.NewENSAdaptor(ens.Config{MainDomain: "promisecard.eth"})
+	defer ensService.Close()
+	if _, err := CheckNick(store, ensService, "a.b"); !errors.Is(err, ens.ErrBadLabel) {
+		t.Fatalf("Expected ErrBadLabel, got %v", err)
+	}
+
+	// Only one of concurrent requests reserves the nick
+	var wg sync.WaitGroup
+	var reserved int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(jobID string) {
+			defer wg.Done()
+			err := reserveNick(store, "alice", jobID)
+			if err == nil {
+				atomic.AddInt32(&reserved, 1)
+			} else if !errors.Is(err, ens.ErrNameTaken) {
+				t.Error(err)
+			}
+		}(fmt.Sprint(i))
+	}
+	wg.Wait()
+	if reserved != 1 {
+		t.Fatalf("Nick reserved %d times", reserved)
+	}
+
+	// Reservation of another job is kept
+	if err := reserveNick(store, "bob", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := releaseNick(store, "bob", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reserveNick(store, "bob", "2"); !errors.Is(err, ens.ErrNameTaken) {
+		t.Fatalf("Expected ErrNameTaken, got %v", err)
+	}
+	if err := releaseNick(store, "bob", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reserveNick(store, "bob", "2"); err != nil {
+		t.Fatalf("Released nick is not free: %v", err)
+	}
+}
@@ -0,0 +1,464 @@
+package usecases
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+	"go.uber.org/zap"
+)
+
+const authCodeTTL = time.Minute
+
+// OAuth2 error response, Code is the RFC 6749 error code
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+func oauthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// Relying party registered to log in users with promise cards
+type OAuthClient struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	SecretHash   string    `json:"secret_hash"` // empty for public clients
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Register client. Secret of confidential client is returned only once
+func RegisterOAuthClient(store polybase.RecordStore, name string, redirectURIs []string, confidential bool) (client OAuthClient, secret string, err error) {
+	if len(redirectURIs) == 0 {
+		return client, "", oauthError("invalid_request", "redirect_uris required")
+	}
+	for _, uri := range redirectURIs {
+		if u, err := url.Parse(uri); err != nil || !u.IsAbs() || u.Fragment != "" {
+			return client, "", oauthError("invalid_request", fmt.Sprintf("bad redirect uri %s", uri))
+		}
+	}
+	client = OAuthClient{
+		ID:           uuid.NewString(),
+		Name:         name,
+		RedirectURIs: redirectURIs,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if confidential {
+		if secret, err = randomToken(); err != nil {
+			return
+		}
+		client.SecretHash = hashToken(secret)
+	}
+	fields, err := toFields(client)
+	if err != nil {
+		return
+	}
+	_, err = store.Create(OAuthClientCollection, client.ID, fields)
+	return
+}
+
+func GetOAuthClient(store polybase.RecordStore, id string) (client OAuthClient, err error) {
+	rec, err := store.Get(OAuthClientCollection, id)
+	if err != nil {
+		return
+	}
+	err = fromFields(rec, &client)
+	return
+}
+
+func ListOAuthClients(store polybase.RecordStore, cursor string, limit int) (clients []OAuthClient, next string, err error) {
+	records, next, err := store.List(OAuthClientCollection, cursor, limit)
+	if err != nil {
+		return
+	}
+	clients = make([]OAuthClient, 0, len(records))
+	for _, rec := range records {
+		var client OAuthClient
+		if err = fromFields(rec, &client); err != nil {
+			return
+		}
+		clients = append(clients, client)
+	}
+	return
+}
+
+func (c OAuthClient) hasRedirectURI(uri string) bool {
+	for _, u := range c.RedirectURIs {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorization code. Only the hash of the code is stored
+type AuthCode struct {
+	ID            string    `json:"id"`
+	ClientID      string    `json:"client_id"`
+	RedirectURI   string    `json:"redirect_uri"`
+	Subject       string    `json:"subject"`
+	Scope         string    `json:"scope"`
+	Nonce         string    `json:"nonce"`
+	CodeChallenge string    `json:"code_challenge"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	Used          bool      `json:"used"`
+	Version       int       `json:"version"` // store version, the exchange claims the code only if it was not changed after it was read
+}
+
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+type OIDCTokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	ClientID     string
+	ClientSecret string
+	CodeVerifier string
+	RefreshToken string
+}
+
+type OIDCTokens struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// OpenID Connect provider with authorization code flow and mandatory PKCE S256
+type OIDCProvider struct {
+	users GetUserUseCase
+}
+
+func NewOIDCProvider(users GetUserUseCase) OIDCProvider {
+	return OIDCProvider{users: users}
+}
+
+// Browser authorization request. The checked request is passed to the login page of the
+// promise card app, which logs the user in and completes the request with Authorize.
+// Unknown client or redirect uri are returned as errors, other errors are sent to the redirect uri
+func (p *OIDCProvider) LoginRedirect(req AuthorizeRequest, loginURL string) (string, error) {
+	if err := p.checkRedirect(req); err != nil {
+		return "", err
+	}
+	if err := checkAuthorizeRequest(req); err != nil {
+		return clientRedirect(req, err)
+	}
+	if loginURL == "" {
+		return clientRedirect(req, oauthError("temporarily_unavailable", "login page is not configured"))
+	}
+	login, err := url.Parse(loginURL)
+	if err != nil {
+		return "", err
+	}
+	query := login.Query()
+	for key, value := range map[string]string{
+		"response_type":         req.ResponseType,
+		"client_id":             req.ClientID,
+		"redirect_uri":          req.RedirectURI,
+		"scope":                 req.Scope,
+		"state":                 req.State,
+		"nonce":                 req.Nonce,
+		"code_challenge":        req.CodeChallenge,
+		"code_challenge_method": req.CodeChallengeMethod,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	login.RawQuery = query.Encode()
+	return login.String(), nil
+}
+
+// Issue authorization code for the logged in user and return the client redirect.
+// Unknown client or redirect uri are returned as errors, other errors are sent to the redirect uri
+func (p *OIDCProvider) Authorize(req AuthorizeRequest, subject string) (string, error) {
+	if err := p.checkRedirect(req); err != nil {
+		return "", err
+	}
+	code, err := p.authorize(req, subject)
+	if err != nil {
+		return clientRedirect(req, err)
+	}
+	redirect, _ := url.Parse(req.RedirectURI)
+	query := redirect.Query()
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	query.Set("code", code)
+	redirect.RawQuery = query.Encode()
+	return redirect.String(), nil
+}
+
+// Redirect uri is registered by the client
+func (p *OIDCProvider) checkRedirect(req AuthorizeRequest) error {
+	client, err := GetOAuthClient(p.users.store, req.ClientID)
+	if errors.Is(err, polybase.ErrNotFound) {
+		return oauthError("invalid_client", "unknown client")
+	}
+	if err != nil {
+		return err
+	}
+	if !client.hasRedirectURI(req.RedirectURI) {
+		return oauthError("invalid_request", "redirect_uri is not registered")
+	}
+	return nil
+}
+
+// Client redirect with the OAuth error, other errors are returned
+func clientRedirect(req AuthorizeRequest, err error) (string, error) {
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) {
+		return "", err
+	}
+	redirect, _ := url.Parse(req.RedirectURI)
+	query := redirect.Query()
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	query.Set("error", oauthErr.Code)
+	query.Set("error_description", oauthErr.Description)
+	redirect.RawQuery = query.Encode()
+	return redirect.String(), nil
+}
+
+func checkAuthorizeRequest(req AuthorizeRequest) error {
+	if req.ResponseType != "code" {
+		return oauthError("unsupported_response_type", "only code response type is supported")
+	}
+	if !hasScope(req.Scope, "openid") {
+		return oauthError("invalid_scope", "openid scope required")
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return oauthError("invalid_request", "S256 code challenge required")
+	}
+	return nil
+}
+
+func (p *OIDCProvider) authorize(req AuthorizeRequest, subject string) (string, error) {
+	if err := checkAuthorizeRequest(req); err != nil {
+		return "", err
+	}
+	if _, err := GetUserRecord(p.users.store, subject); err != nil {
+		return "", err
+	}
+	code, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	fields, err := toFields(AuthCode{
+		ID:            hashToken(code),
+		ClientID:      req.ClientID,
+		RedirectURI:   req.RedirectURI,
+		Subject:       subject,
+		Scope:         req.Scope,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(authCodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	if _, err := p.users.store.Create(AuthCodeCollection, hashToken(code), fields); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// Token endpoint: exchange authorization code or refresh token.
+// Both grants authenticate the client, refresh tokens are bound to the client they are issued to
+func (p *OIDCProvider) Exchange(req OIDCTokenRequest) (OIDCTokens, error) {
+	switch req.GrantType {
+	case "authorization_code":
+		client, err := p.authenticateClient(req)
+		if err != nil {
+			return OIDCTokens{}, err
+		}
+		return p.exchangeCode(client, req)
+	case "refresh_token":
+		client, err := p.authenticateClient(req)
+		if err != nil {
+			return OIDCTokens{}, err
+		}
+		tokens, err := p.users.sessions.refresh(req.RefreshToken, client.ID)
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrUserDisabled) {
+			return OIDCTokens{}, oauthError("invalid_grant", err.Error())
+		}
+		if err != nil {
+			return OIDCTokens{}, err
+		}
+		return OIDCTokens{
+			AccessToken:  tokens.AccessToken,
+			TokenType:    "Bearer",
+			ExpiresIn:    tokens.ExpiresIn,
+			RefreshToken: tokens.RefreshToken,
+		}, nil
+	default:
+		return OIDCTokens{}, oauthError("unsupported_grant_type", req.GrantType)
+	}
+}
+
+// Confidential clients authenticate with the secret, public clients only by the client id
+func (p *OIDCProvider) authenticateClient(req OIDCTokenRequest) (OAuthClient, error) {
+	client, err := GetOAuthClient(p.users.store, req.ClientID)
+	if errors.Is(err, polybase.ErrNotFound) {
+		return client, oauthError("invalid_client", "unknown client")
+	}
+	if err != nil {
+		return client, err
+	}
+	if client.SecretHash != "" && subtle.ConstantTimeCompare([]byte(hashToken(req.ClientSecret)), []byte(client.SecretHash)) != 1 {
+		return client, oauthError("invalid_client", "bad client secret")
+	}
+	return client, nil
+}
+
+func (p *OIDCProvider) exchangeCode(client OAuthClient, req OIDCTokenRequest) (OIDCTokens, error) {
+	code, err := p.claimCode(req.Code)
+	if err != nil {
+		return OIDCTokens{}, err
+	}
+	if time.Now().After(code.ExpiresAt) || code.ClientID != client.ID || code.RedirectURI != req.RedirectURI {
+		return OIDCTokens{}, oauthError("invalid_grant", "code expired or issued to another client")
+	}
+	challenge := sha256.Sum256([]byte(req.CodeVerifier))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != code.CodeChallenge {
+		return OIDCTokens{}, oauthError("invalid_grant", "code verifier mismatch")
+	}
+
+	user, err := GetUserRecord(p.users.store, code.Subject)
+	if err != nil {
+		return OIDCTokens{}, err
+	}
+	if user.Disabled {
+		return OIDCTokens{}, oauthError("invalid_grant", ErrUserDisabled.Error())
+	}
+	userData, err := p.users.userData(user)
+	if err != nil {
+		return OIDCTokens{}, err
+	}
+	tokens, err := p.users.sessions.start(user.Address, userData, nil, client.ID)
+	if err != nil {
+		return OIDCTokens{}, err
+	}
+	idToken, err := CreateIDToken(p.users.sessions.issuer, p.users.sessions.accessTTL, user.Address, client.ID, code.Nonce, p.profile(user, userData))
+	if err != nil {
+		return OIDCTokens{}, err
+	}
+	return OIDCTokens{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    tokens.ExpiresIn,
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      idToken,
+	}, nil
+}
+
+// Mark the code used. Code is single use, concurrent exchange of the same code claims it first
+// and the other one gets invalid_grant. Used code is deleted, codes left by failed deletes are collected later
+func (p *OIDCProvider) claimCode(value string) (code AuthCode, err error) {
+	id := hashToken(value)
+	rec, err := p.users.store.Get(AuthCodeCollection, id)
+	if errors.Is(err, polybase.ErrNotFound) {
+		return code, oauthError("invalid_grant", "unknown code")
+	}
+	if err != nil {
+		return
+	}
+	if err = fromFields(rec, &code); err != nil {
+		return
+	}
+	if code.Used {
+		return code, oauthError("invalid_grant", "code already used")
+	}
+	_, err = p.users.store.UpdateVersion(AuthCodeCollection, id, code.Version, map[string]interface{}{"used": true})
+	if errors.Is(err, polybase.ErrVersionConflict) || errors.Is(err, polybase.ErrNotFound) {
+		return code, oauthError("invalid_grant", "code already used")
+	}
+	if err != nil {
+		return
+	}
+	if err := p.users.store.Delete(AuthCodeCollection, id); err != nil && !errors.Is(err, polybase.ErrNotFound) {
+		zap.L().Warn("Delete used authorization code error", zap.Error(err))
+	}
+	return code, nil
+}
+
+// Userinfo claims of the user
+func (p *OIDCProvider) UserInfo(address string) (map[string]interface{}, error) {
+	user, err := GetUserRecord(p.users.store, address)
+	if err != nil {
+		return nil, err
+	}
+	userData, err := p.users.userData(user)
+	if err != nil {
+		return nil, err
+	}
+	profile := p.profile(user, userData)
+	profile["sub"] = user.Address
+	return profile, nil
+}
+
+func (p *OIDCProvider) profile(user User, userData map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"nick":               user.Nick,
+		"preferred_username": user.Nick,
+		"ens_name":           p.users.ensService.Subdomain(user.Nick),
+		"avatar":             userData["avatar"],
+		"picture":            userData["avatar"],
+	}
+}
+
+// Create OpenID Connect id token with the service key
+func CreateIDToken(issuer *auth.Issuer, ttl time.Duration, subject, audience, nonce string, profile map[string]interface{}) (string, error) {
+	now := time.Now().UTC()
+
+	claims := make(jwt.MapClaims)
+	for k, v := range profile {
+		claims[k] = v
+	}
+	claims["exp"] = now.Add(ttl).Unix()
+	claims["iat"] = now.Unix()
+	claims["auth_time"] = now.Unix()
+	claims["iss"] = issuer.Name
+	claims["sub"] = subject
+	claims["aud"] = audience
+	claims["token_use"] = auth.TokenUseID
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	return issuer.Sign(claims, nil)
+}
+
+func hasScope(scope, want string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package usecases
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
+	"github.com/torvald2/hack-fs-2023-promise-card/ens"
+)
+
+func TestOIDCAuthorize(t *testing.T) {
+	store := newTestStore(t, User{Address: "0xabc", Nick: "alice"})
+	client, secret, err := RegisterOAuthClient(store, "app", []string{"https://app.example/cb"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := NewOIDCProvider(NewGetUserUseCase(store, nil, nil, nil))
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := sha256.Sum256([]byte(verifier))
+	req := AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            client.ID,
+		RedirectURI:         "https://app.example/cb",
+		Scope:               "openid profile",
+		State:               "xyz",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(challenge[:]),
+		CodeChallengeMethod: "S256",
+	}
+
+	var oauthErr *OAuthError
+	bad := req
+	bad.RedirectURI = "https://evil.example/cb"
+	if _, err := provider.Authorize(bad, "0xabc"); !errors.As(err, &oauthErr) {
+		t.Fatalf("Expected OAuthError, got %v", err)
+	}
+
+	// Errors after client check are sent to the client
+	bad = req
+	bad.CodeChallengeMethod = "plain"
+	redirect, err := provider.Authorize(bad, "0xabc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(redirect)
+	if u.Query().Get("error") != "invalid_request" || u.Query().Get("state") != "xyz" {
+		t.Fatalf("Unexpected redirect %s", redirect)
+	}
+
+	redirect, err = provider.Authorize(req, "0xabc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ = url.Parse(redirect)
+	code := u.Query().Get("code")
+	if code == "" {
+		t.Fatalf("Expected code in %s", redirect)
+	}
+
+	exchange := OIDCTokenRequest{
+		GrantType:    "authorization_code",
+		Code:         code,
+		RedirectURI:  req.RedirectURI,
+		ClientID:     client.ID,
+		ClientSecret: "wrong",
+		CodeVerifier: "wrong",
+	}
+	if _, err := provider.Exchange(exchange); !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_client" {
+		t.Fatalf("Expected invalid_client, got %v", err)
+	}
+	exchange.ClientSecret = secret
+	if _, err := provider.Exchange(exchange); !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+		t.Fatalf("Expected invalid_grant, got %v", err)
+	}
+	// Code is single use
+	exchange.CodeVerifier = verifier
+	if _, err := provider.Exchange(exchange); !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+		t.Fatalf("Expected invalid_grant, got %v", err)
+	}
+}
+
+func TestOIDCCodeExchange(t *testing.T) {
+	store := newTestStore(t, User{Address: "0xabc", Nick: "alice"})
+	client, secret, err := RegisterOAuthClient(store, "app", []string{"https://app.example/cb"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := RegisterOAuthClient(store, "other", []string{"https://other.example/cb"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring, _ := auth.NewKeyring("", auth.AlgES256, 1)
+	issuer, _ := auth.NewIssuer("test", auth.SignWithServiceKey, keyring)
+	sessions := NewSessionUseCase(store, issuer, time.Minute, time.Hour)
+	// Avatar of the closed service is not resolved, tokens are issued without it
+	ensService := ens.NewENSAdaptor(ens.Config{MainDomain: "promisecard.eth"})
+	ensService.Close()
+	provider := NewOIDCProvider(NewGetUserUseCase(store, nil, sessions, ensService))
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := sha256.Sum256([]byte(verifier))
+	req := AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            client.ID,
+		RedirectURI:         "https://app.example/cb",
+		Scope:               "openid",
+		Nonce:               "n-0S6",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(challenge[:]),
+		CodeChallengeMethod: "S256",
+	}
+	login, err := provider.LoginRedirect(req, "https://card.example/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := url.Parse(login); u.Host != "card.example" || u.Query().Get("code_challenge") != req.CodeChallenge {
+		t.Fatalf("Unexpected login redirect %s", login)
+	}
+	authorize := func() string {
+		redirect, err := provider.Authorize(req, "0xabc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, _ := url.Parse(redirect)
+		return u.Query().Get("code")
+	}
+
+	var oauthErr *OAuthError
+	exchange := OIDCTokenRequest{
+		GrantType:    "authorization_code",
+		Code:         authorize(),
+		RedirectURI:  req.RedirectURI,
+		ClientID:     client.ID,
+		ClientSecret: secret,
+		CodeVerifier: "wrong-verifier",
+	}
+	if _, err := provider.Exchange(exchange); !errors.As(err, &oauthErr) || oauthErr.Description != "code verifier mismatch" {
+		t.Fatalf("Expected code verifier mismatch, got %v", err)
+	}
+
+	exchange.Code = authorize()
+	exchange.CodeVerifier = verifier
+	tokens, err := provider.Exchange(exchange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.NewVerifier("test", keyring).Verify(tokens.AccessToken); err != nil {
+		t.Fatalf("Bad access token: %v", err)
+	}
+	idToken := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(tokens.IDToken, idToken); err != nil {
+		t.Fatal(err)
+	}
+	if idToken["aud"] != client.ID || idToken["nonce"] != "n-0S6" || idToken["sub"] != "0xabc" {
+		t.Fatalf("Unexpected id token claims %v", idToken)
+	}
+	if _, err := provider.Exchange(exchange); !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+		t.Fatalf("Reused code: expected invalid_grant, got %v", err)
+	}
+
+	// Concurrent exchange claims the code between the read and the claim
+	exchange.Code = authorize()
+	racing := hookStore{store, func() error {
+		_, err := store.Update(AuthCodeCollection, hashToken(exchange.Code), map[string]interface{}{"used": true})
+		return err
+	}}
+	racingProvider := NewOIDCProvider(NewGetUserUseCase(racing, nil, sessions, ensService))
+	if _, err := racingProvider.Exchange(exchange); !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+		t.Fatalf("Concurrently exchanged code: expected invalid_grant, got %v", err)
+	}
+	if _, err := provider.Exchange(exchange); !errors.As(err, &oauthErr) || oauthErr.Description != "code already used" {
+		t.Fatalf("Used code: expected code already used, got %v", err)
+	}
+
+	// Refresh token is bound to the client
+	if _, err := sessions.Refresh(tokens.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("Client refresh token refreshed without the client: %v", err)
+	}
+	refresh := OIDCTokenRequest{GrantType: "refresh_token", RefreshToken: tokens.RefreshToken, ClientID: other.ID}
+	if _, err := provider.Exchange(refresh); !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+		t.Fatalf("Refresh by another client: expected invalid_grant, got %v", err)
+	}
+	refresh.ClientID = client.ID
+	if _, err := provider.Exchange(refresh); !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_client" {
+		t.Fatalf("Refresh without the secret: expected invalid_client, got %v", err)
+	}
+	refresh.ClientSecret = secret
+	if _, err := provider.Exchange(refresh); err != nil {
+		t.Fatal(err)
+	}
+}
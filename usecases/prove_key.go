@@ -0,0 +1,72 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
+)
+
+var ErrKeyNotProved = errors.New("signature does not match user address")
+
+type Challenge struct {
+	Nonce   string `json:"nonce"`
+	Message string `json:"message"` // message to sign with personal_sign
+}
+
+// Non-custodial login: client opens the sealed key itself and signs the server challenge
+type ProveKeyUseCase struct {
+	users  GetUserUseCase
+	nonces *auth.NonceStore
+}
+
+func NewProveKeyUseCase(users GetUserUseCase, nonces *auth.NonceStore) ProveKeyUseCase {
+	return ProveKeyUseCase{
+		users:  users,
+		nonces: nonces,
+	}
+}
+
+func challengeMessage(address, nonce string) string {
+	return fmt.Sprintf("Sign in to promise cards with the key of %s\nNonce: %s", address, nonce)
+}
+
+// Issue challenge for the user address
+func (c *ProveKeyUseCase) Challenge(address string) (challenge Challenge, err error) {
+	if _, err = GetUserRecord(c.users.store, address); err != nil {
+		return
+	}
+	challenge.Nonce, err = c.nonces.Issue(address)
+	challenge.Message = challengeMessage(address, challenge.Nonce)
+	return
+}
+
+// Check challenge signature by the user key and start session.
+// Token is signed by the service key, the user key never reaches the server
+func (c *ProveKeyUseCase) Execute(address, nonce, signature string) (tokens TokenPair, err error) {
+	signer, err := auth.RecoverPersonalSigner(challengeMessage(address, nonce), signature)
+	if err != nil {
+		return
+	}
+	if !common.IsHexAddress(address) || signer != common.HexToAddress(address) {
+		err = ErrKeyNotProved
+		return
+	}
+	if !c.nonces.Consume(nonce, address) {
+		err = ErrInvalidNonce
+		return
+	}
+	user, err := GetUserRecord(c.users.store, address)
+	if err != nil {
+		return
+	}
+	if err = c.users.checkUnlocked(user); err != nil {
+		return
+	}
+	userData, err := c.users.userData(user)
+	if err != nil {
+		return
+	}
+	return c.users.sessions.Start(user.Address, userData, nil)
+}
@@ -0,0 +1,88 @@
+package usecases
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
+	"github.com/torvald2/hack-fs-2023-promise-card/ens"
+	"github.com/torvald2/hack-fs-2023-promise-card/timelock"
+)
+
+func TestProveKey(t *testing.T) {
+	store := newTestStore(t)
+	network, err := timelock.NewLocalNetwork(nil, time.Now().Add(-time.Hour), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	round := network.RoundNumber(time.Now().Add(time.Hour))
+	sealed, err := timelock.Seal(network, []byte(hexutil.Encode(crypto.FromECDSA(key))), round)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createTestUser(t, store, User{Address: address, SealedKey: hex.EncodeToString(sealed), Round: round})
+
+	keyring, _ := auth.NewKeyring("", auth.AlgES256, 1)
+	issuer, _ := auth.NewIssuer("test", auth.SignWithServiceKey, keyring)
+	sessions := NewSessionUseCase(store, issuer, time.Minute, time.Hour)
+	ensService := ens.NewENSAdaptor(ens.Config{MainDomain: "promisecard.eth"})
+	ensService.Close()
+	users := NewGetUserUseCase(store, network, sessions, ensService)
+	us := NewProveKeyUseCase(users, auth.NewNonceStore(time.Minute, 100))
+	sign := func(challenge Challenge, key *ecdsa.PrivateKey) string {
+		sig, err := crypto.Sign(accounts.TextHash([]byte(challenge.Message)), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hexutil.Encode(sig)
+	}
+
+	challenge, err := us.Challenge(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := crypto.GenerateKey()
+	if _, err := us.Execute(address, challenge.Nonce, sign(challenge, other)); !errors.Is(err, ErrKeyNotProved) {
+		t.Fatalf("Expected ErrKeyNotProved, got %v", err)
+	}
+
+	// Key holder can't log in before the unlock round
+	var locked *timelock.LockedError
+	if _, err := us.Execute(address, challenge.Nonce, sign(challenge, key)); !errors.As(err, &locked) {
+		t.Fatalf("Expected LockedError, got %v", err)
+	}
+	if _, err := us.Execute(address, challenge.Nonce, sign(challenge, key)); !errors.Is(err, ErrInvalidNonce) {
+		t.Fatalf("Expected ErrInvalidNonce, got %v", err)
+	}
+
+	network.Advance(uint64(time.Hour / time.Second))
+	challenge, err = us.Challenge(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := us.Execute(address, challenge.Nonce, sign(challenge, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := auth.NewVerifier("test", keyring).Verify(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != address || tokens.RefreshToken == "" {
+		t.Fatalf("Unexpected tokens %+v, claims %+v", tokens, claims)
+	}
+	if _, err := us.Execute(address, challenge.Nonce, sign(challenge, key)); !errors.Is(err, ErrInvalidNonce) {
+		t.Fatalf("Expected ErrInvalidNonce on reuse, got %v", err)
+	}
+}
@@ -0,0 +1,362 @@
+package usecases
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/torvald2/hack-fs-2023-promise-card/ens"
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+	"go.uber.org/zap"
+)
+
+// Job statuses
+const (
+	JobQueued         = "queued"
+	JobRunning        = "running"
+	JobDone           = "done"
+	JobCompensating   = "compensating"
+	JobRolledBack     = "rolled_back"
+	JobRollbackFailed = "rollback_failed"
+	JobFailed         = "failed" // job without compensation steps failed
+)
+
+// Job kinds, jobs without kind provision users
+const (
+	JobKindCreateUser  = "create_user"
+	JobKindTextRecords = "text_records"
+)
+
+// Job step statuses
+const (
+	StepStatusPending     = "pending"
+	StepStatusDone        = "done"
+	StepStatusFailed      = "failed"
+	StepStatusCompensated = "compensated"
+)
+
+type JobStep struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+// User provisioning or subdomain update job. Saved to the record store after every step
+type ProvisionJob struct {
+	ID             string             `json:"id"`
+	Kind           string             `json:"kind"`
+	Status         string             `json:"status"`
+	Nick           string             `json:"nick"`
+	Duration       time.Duration      `json:"duration"`
+	Avatar         string             `json:"avatar"` // base64 image, removed after pinning
+	Schedule       []ScheduledPayload `json:"schedule"`
+	Shamir         *ShamirSpec        `json:"shamir"`
+	KeyShares      []ScheduledPayload `json:"key_shares"`
+	GuardianShares []GuardianShare    `json:"guardian_shares"`
+	Steps          []JobStep          `json:"steps"`
+	Address        string             `json:"address"`
+	Roles          []string           `json:"roles"`
+	EncryptedKey   string             `json:"private_key_encrypted"`
+	Round          uint64             `json:"round"`
+	UnlockAt       time.Time          `json:"unlock_at"`
+	CID            string             `json:"cid"`
+	SubdomainTx    []ens.TxRecord     `json:"subdomain_txs"`
+	AvatarTx       []ens.TxRecord     `json:"avatar_txs"`
+	ReleaseTx      []ens.TxRecord     `json:"release_txs"`
+	ReverseTx      []ens.TxRecord     `json:"reverse_txs"`
+	HandoverTx     []ens.TxRecord     `json:"handover_txs"`
+	Records        map[string]string  `json:"records"` // text records of the text records job
+	RecordsTx      []ens.TxRecord     `json:"records_txs"`
+	Error          string             `json:"error"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+
+	// Transaction hashes of jobs saved before transaction records, moved to the records on load
+	LegacySubdomainTx string `json:"subdomain_tx,omitempty"`
+	LegacyAvatarTx    string `json:"avatar_tx,omitempty"`
+	LegacyReleaseTx   string `json:"release_tx,omitempty"`
+}
+
+// Move legacy transaction hashes to transaction records, their confirmation status is unknown
+func (j *ProvisionJob) migrateTxs() {
+	for _, tx := range []struct {
+		legacy  *string
+		records *[]ens.TxRecord
+	}{
+		{&j.LegacySubdomainTx, &j.SubdomainTx},
+		{&j.LegacyAvatarTx, &j.AvatarTx},
+		{&j.LegacyReleaseTx, &j.ReleaseTx},
+	} {
+		if *tx.legacy != "" && len(*tx.records) == 0 {
+			*tx.records = []ens.TxRecord{{Hash: *tx.legacy, Status: ens.TxPending}}
+		}
+		*tx.legacy = ""
+	}
+}
+
+func (j *ProvisionJob) step(name string) *JobStep {
+	for i := range j.Steps {
+		if j.Steps[i].Name == name {
+			return &j.Steps[i]
+		}
+	}
+	j.Steps = append(j.Steps, JobStep{Name: name, Status: StepStatusPending})
+	return &j.Steps[len(j.Steps)-1]
+}
+
+// Queue of user provisioning and text records jobs.
+// Jobs are executed by background workers, job state is kept in the record store
+type Provisioner struct {
+	store   polybase.RecordStore
+	useCase CreateUserUseCase
+	records TextRecordsUseCase
+	queue   chan string
+	stop    chan struct{}
+	workers sync.WaitGroup
+
+	mu       sync.Mutex
+	queued   map[string]bool // jobs in the queue or running
+	overflow bool            // a job did not fit into the queue and waits in the store
+}
+
+func NewProvisioner(store polybase.RecordStore, useCase CreateUserUseCase) *Provisioner {
+	return &Provisioner{
+		store:   store,
+		useCase: useCase,
+		records: NewTextRecordsUseCase(store, useCase.ensService),
+		queue:   make(chan string, 100),
+		stop:    make(chan struct{}),
+		queued:  make(map[string]bool),
+	}
+}
+
+// Start job workers
+func (p *Provisioner) Start(workers int) {
+	for i := 0; i < workers; i++ {
+		p.workers.Add(1)
+		go p.work()
+	}
+}
+
+// Stop workers and wait for the running jobs until the context is done. Queued and interrupted jobs
+// stay in the store and are resumed on start, their sent ENS transactions are not sent again
+func (p *Provisioner) Stop(ctx context.Context) error {
+	close(p.stop)
+	done := make(chan struct{})
+	go func() {
+		p.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Provisioner) work() {
+	defer p.workers.Done()
+	for {
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+		select {
+		case <-p.stop:
+			return
+		case id := <-p.queue:
+			p.run(id)
+			p.done(id)
+		}
+	}
+}
+
+// Put the job to the queue unless it is queued already. Full queue doesn't block,
+// the job stays queued in the store and is resumed when the queue is drained
+func (p *Provisioner) push(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.queued[id] {
+		return
+	}
+	select {
+	case p.queue <- id:
+		p.queued[id] = true
+	default:
+		p.overflow = true
+		zap.L().Warn("Provisioning queue is full, job is resumed later", zap.String("job", id))
+	}
+}
+
+// Resume jobs left in the store by a full queue once the queue is drained
+func (p *Provisioner) done(id string) {
+	p.mu.Lock()
+	delete(p.queued, id)
+	resume := p.overflow && len(p.queue) == 0
+	if resume {
+		p.overflow = false
+	}
+	p.mu.Unlock()
+	if resume {
+		if err := p.Resume(); err != nil {
+			zap.L().Error("Resume provisioning jobs error", zap.Error(err))
+		}
+	}
+}
+
+func resumable(status string) bool {
+	return status == JobQueued || status == JobRunning || status == JobCompensating
+}
+
+func (p *Provisioner) run(id string) {
+	job, err := GetJob(p.store, id)
+	if err != nil {
+		zap.L().Error("Load provisioning job error", zap.String("job", id), zap.Error(err))
+		return
+	}
+	if !resumable(job.Status) {
+		return
+	}
+	execute := p.useCase.Execute
+	if job.Kind == JobKindTextRecords {
+		execute = p.records.Execute
+	}
+	if err := execute(&job, p.save); err != nil {
+		zap.L().Error("Provisioning job failed", zap.String("job", id), zap.Error(err))
+		return
+	}
+	zap.L().Info("Provisioning job done", zap.String("job", id), zap.String("address", job.Address))
+}
+
+func (p *Provisioner) save(job *ProvisionJob) error {
+	job.UpdatedAt = time.Now().UTC()
+	fields, err := toFields(job)
+	if err != nil {
+		return err
+	}
+	_, err = p.store.Update(JobCollection, job.ID, fields)
+	return err
+}
+
+type ProvisionRequest struct {
+	Nick     string
+	Duration time.Duration
+	Avatar   string
+	Schedule []PayloadSpec
+	Shamir   *ShamirSpec
+}
+
+// Reserve the normalized and available nick, save new provisioning job and put it to the queue
+func (p *Provisioner) Enqueue(req ProvisionRequest) (ProvisionJob, error) {
+	nick, err := CheckNick(p.store, p.useCase.ensService, req.Nick)
+	if err != nil {
+		return ProvisionJob{}, err
+	}
+	now := time.Now().UTC()
+	job := ProvisionJob{
+		ID:        uuid.NewString(),
+		Kind:      JobKindCreateUser,
+		Status:    JobQueued,
+		Nick:      nick,
+		Duration:  req.Duration,
+		Avatar:    req.Avatar,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	schedule, err := SealSchedule(p.useCase.network, req.Schedule)
+	if err != nil {
+		return job, err
+	}
+	job.Schedule = schedule
+	if req.Shamir != nil {
+		if err := req.Shamir.validate(); err != nil {
+			return job, err
+		}
+		job.Shamir = req.Shamir
+	}
+	for _, step := range p.useCase.steps(nil) {
+		job.step(step.name)
+	}
+	if err := reserveNick(p.store, nick, job.ID); err != nil {
+		return job, err
+	}
+	if err := p.enqueue(job); err != nil {
+		if releaseErr := releaseNick(p.store, nick, job.ID); releaseErr != nil {
+			zap.L().Error("Release nick error", zap.String("nick", nick), zap.Error(releaseErr))
+		}
+		return job, err
+	}
+	return job, nil
+}
+
+// Save new text records job of the user subdomain and put it to the queue
+func (p *Provisioner) EnqueueTextRecords(address string, records map[string]string) (ProvisionJob, error) {
+	user, err := p.records.check(address, records)
+	if err != nil {
+		return ProvisionJob{}, err
+	}
+	now := time.Now().UTC()
+	job := ProvisionJob{
+		ID:        uuid.NewString(),
+		Kind:      JobKindTextRecords,
+		Status:    JobQueued,
+		Nick:      user.Nick,
+		Address:   user.Address,
+		Records:   records,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	job.step(StepTextRecords)
+	return job, p.enqueue(job)
+}
+
+func (p *Provisioner) enqueue(job ProvisionJob) error {
+	fields, err := toFields(job)
+	if err != nil {
+		return err
+	}
+	if _, err := p.store.Create(JobCollection, job.ID, fields); err != nil {
+		return err
+	}
+	p.push(job.ID)
+	return nil
+}
+
+// Put unfinished jobs left after restart or by a full queue back to the queue
+func (p *Provisioner) Resume() error {
+	cursor := ""
+	for {
+		records, next, err := p.store.List(JobCollection, cursor, 100)
+		if err != nil {
+			return err
+		}
+		for _, rec := range records {
+			var job ProvisionJob
+			if err := fromFields(rec, &job); err != nil {
+				return err
+			}
+			if resumable(job.Status) {
+				p.push(job.ID)
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func GetJob(store polybase.RecordStore, id string) (job ProvisionJob, err error) {
+	rec, err := store.Get(JobCollection, id)
+	if err != nil {
+		return
+	}
+	if err = fromFields(rec, &job); err != nil {
+		return
+	}
+	job.migrateTxs()
+	return
+}
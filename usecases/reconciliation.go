@@ -0,0 +1,68 @@
+package usecases
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+	"go.uber.org/zap"
+)
+
+// Reconciliation entry statuses
+const (
+	ReconciliationDone   = "done"
+	ReconciliationFailed = "failed"
+)
+
+// Record of the compensating action made after failed user provisioning
+type ReconciliationEntry struct {
+	ID        string    `json:"id"`
+	JobID     string    `json:"job_id"`
+	Address   string    `json:"address"`
+	Nick      string    `json:"nick"`
+	Step      string    `json:"step"`
+	Action    string    `json:"action"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func saveReconciliation(store polybase.RecordStore, entry ReconciliationEntry) error {
+	entry.CreatedAt = time.Now().UTC()
+	// Time prefixed id keeps the log ordered
+	entry.ID = fmt.Sprintf("%020d-%s", entry.CreatedAt.UnixNano(), uuid.NewString())
+	fields, err := toFields(entry)
+	if err != nil {
+		return err
+	}
+	zap.L().Warn("Provisioning step compensated",
+		zap.String("job", entry.JobID),
+		zap.String("step", entry.Step),
+		zap.String("action", entry.Action),
+		zap.String("status", entry.Status),
+		zap.String("error", entry.Error),
+	)
+	_, err = store.Create(ReconciliationCollection, entry.ID, fields)
+	return err
+}
+
+// List reconciliation log page. Empty jobID means entries of all jobs
+func ListReconciliation(store polybase.RecordStore, jobID, cursor string, limit int) (entries []ReconciliationEntry, next string, err error) {
+	records, next, err := store.List(ReconciliationCollection, cursor, limit)
+	if err != nil {
+		return
+	}
+	entries = make([]ReconciliationEntry, 0, len(records))
+	for _, rec := range records {
+		var entry ReconciliationEntry
+		if err = fromFields(rec, &entry); err != nil {
+			return
+		}
+		if jobID != "" && entry.JobID != jobID {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return
+}
@@ -0,0 +1,23 @@
+package usecases
+
+import "encoding/json"
+
+// Convert struct to the record store fields using its json representation
+func toFields(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+// Fill struct from the record store fields
+func fromFields(fields map[string]interface{}, v interface{}) error {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,33 @@
+package usecases
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+)
+
+// Bolt store in the test temp dir with the users, closed on test cleanup
+func newTestStore(t *testing.T, users ...User) *polybase.BoltStore {
+	t.Helper()
+	store, err := polybase.NewBoltStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	for _, user := range users {
+		createTestUser(t, store, user)
+	}
+	return store
+}
+
+func createTestUser(t *testing.T, store polybase.RecordStore, user User) {
+	t.Helper()
+	fields, err := toFields(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create(UserCollection, user.Address, fields); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,22 @@
+package usecases
+
+import (
+	"github.com/torvald2/hack-fs-2023-promise-card/ens"
+)
+
+// Card records by the subdomain label or full name
+func ResolveName(ensService *ens.ENSAdaptor, name string) (ens.Resolution, error) {
+	label, err := ensService.Label(name)
+	if err != nil {
+		return ens.Resolution{}, err
+	}
+	if label, err = ens.NormalizeLabel(label); err != nil {
+		return ens.Resolution{}, err
+	}
+	return ensService.Resolve(label, DefaultTextKeys)
+}
+
+// Primary name of the card address
+func ReverseResolve(ensService *ens.ENSAdaptor, address string) (string, error) {
+	return ensService.ReverseResolve(address)
+}
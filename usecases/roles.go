@@ -0,0 +1,81 @@
+package usecases
+
+import (
+	"errors"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+)
+
+var ErrUnknownRole = errors.New("unknown role")
+
+// Add role to the user record. Returns current roles of the user
+func GrantRole(store polybase.RecordStore, address, role string) ([]string, error) {
+	if !auth.IsKnownRole(role) {
+		return nil, ErrUnknownRole
+	}
+	user, err := GetUserRecord(store, address)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range user.Roles {
+		if r == role {
+			return user.Roles, nil
+		}
+	}
+	roles := append(user.Roles, role)
+	return roles, saveRoles(store, address, roles)
+}
+
+// Remove role from the user record. Returns current roles of the user
+func RevokeRole(store polybase.RecordStore, address, role string) ([]string, error) {
+	if !auth.IsKnownRole(role) {
+		return nil, ErrUnknownRole
+	}
+	user, err := GetUserRecord(store, address)
+	if err != nil {
+		return nil, err
+	}
+	roles := make([]string, 0, len(user.Roles))
+	for _, r := range user.Roles {
+		if r != role {
+			roles = append(roles, r)
+		}
+	}
+	return roles, saveRoles(store, address, roles)
+}
+
+func saveRoles(store polybase.RecordStore, address string, roles []string) error {
+	_, err := store.Update(UserCollection, address, map[string]interface{}{"roles": roles})
+	return err
+}
+
+// Roles of the user record, unknown users have no roles.
+// Disabled users get ErrUserDisabled
+func UserRoles(store polybase.RecordStore, address string) ([]string, error) {
+	user, err := GetUserRecord(store, address)
+	if errors.Is(err, polybase.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+	return user.Roles, nil
+}
+
+// User record has the role
+func HasRole(store polybase.RecordStore, address, role string) (bool, error) {
+	roles, err := UserRoles(store, address)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range roles {
+		if r == role {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,66 @@
+package usecases
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
+)
+
+func TestRoles(t *testing.T) {
+	store := newTestStore(t, User{Address: "0xabc", Nick: "alice", Roles: []string{auth.RoleUser}})
+	keyring, err := auth.NewKeyring("", auth.AlgES256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := auth.NewIssuer("test", auth.SignWithServiceKey, keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := NewSessionUseCase(store, issuer, time.Minute, time.Hour)
+	verifier := auth.NewVerifier("test", keyring)
+
+	if _, err := GrantRole(store, "0xabc", "root"); !errors.Is(err, ErrUnknownRole) {
+		t.Fatalf("Expected ErrUnknownRole, got %v", err)
+	}
+	roles, err := GrantRole(store, "0xabc", auth.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 2 {
+		t.Fatalf("Unexpected roles %v", roles)
+	}
+	tokens, err := sessions.Start("0xabc", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := verifier.Verify(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claims.HasRole(auth.RoleAdmin) {
+		t.Fatalf("Expected admin role, got %v", claims.Roles)
+	}
+
+	// Refreshed token gets current roles
+	if _, err := RevokeRole(store, "0xabc", auth.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err = sessions.Refresh(tokens.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err = verifier.Verify(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.HasRole(auth.RoleAdmin) || !claims.HasRole(auth.RoleUser) {
+		t.Fatalf("Unexpected roles %v", claims.Roles)
+	}
+
+	// Role checks read the user record, not the claim of the earlier token
+	if admin, err := HasRole(store, "0xabc", auth.RoleAdmin); err != nil || admin {
+		t.Fatalf("Revoked admin role is still granted: %v %v", admin, err)
+	}
+}
@@ -0,0 +1,77 @@
+package usecases
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+	"github.com/torvald2/hack-fs-2023-promise-card/timelock"
+)
+
+var ErrInvalidPayload = errors.New("invalid payload")
+
+// Payload to be timelocked with the card
+type PayloadSpec struct {
+	Label string
+	Data  []byte
+	After time.Duration
+}
+
+// Timelocked payload of the card
+type ScheduledPayload struct {
+	Label      string    `json:"label"`
+	Ciphertext string    `json:"ciphertext"` // hex encoded timelock ciphertext
+	Round      uint64    `json:"round"`
+	UnlockAt   time.Time `json:"unlock_at"`
+	Share      bool      `json:"share"` // Shamir share of the card key
+}
+
+type ScheduleEntry struct {
+	ScheduledPayload
+	Decryptable bool `json:"decryptable"`
+}
+
+// Seal every payload to its own round.
+// Sealing is done before the job is saved so plain payloads are never stored
+func SealSchedule(network timelock.Network, specs []PayloadSpec) ([]ScheduledPayload, error) {
+	schedule := make([]ScheduledPayload, 0, len(specs))
+	labels := make(map[string]bool)
+	now := time.Now()
+	for _, spec := range specs {
+		if spec.Label == "" || labels[spec.Label] {
+			return nil, fmt.Errorf("%w: label must be unique and not empty: %q", ErrInvalidPayload, spec.Label)
+		}
+		labels[spec.Label] = true
+		round := network.RoundNumber(now.Add(spec.After))
+		ciphertext, err := timelock.Seal(network, spec.Data, round)
+		if err != nil {
+			return nil, err
+		}
+		schedule = append(schedule, ScheduledPayload{
+			Label:      spec.Label,
+			Ciphertext: hex.EncodeToString(ciphertext),
+			Round:      round,
+			UnlockAt:   network.RoundTime(round),
+		})
+	}
+	return schedule, nil
+}
+
+// Get timelock schedule of the card with current unlock state of every payload
+func GetSchedule(store polybase.RecordStore, network timelock.Network, address string) ([]ScheduleEntry, error) {
+	user, err := GetUserRecord(store, address)
+	if err != nil {
+		return nil, err
+	}
+	current := network.Current(time.Now())
+	entries := make([]ScheduleEntry, 0, len(user.Schedule))
+	for _, payload := range user.Schedule {
+		entries = append(entries, ScheduleEntry{
+			ScheduledPayload: payload,
+			Decryptable:      current >= payload.Round,
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,38 @@
+package usecases
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/timelock"
+)
+
+func TestSchedule(t *testing.T) {
+	store := newTestStore(t)
+	network, err := timelock.NewLocalNetwork(nil, time.Now().Add(-time.Hour), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schedule, err := SealSchedule(network, []PayloadSpec{
+		{Label: "first", Data: []byte("1"), After: time.Minute},
+		{Label: "second", Data: []byte("2"), After: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SealSchedule(network, []PayloadSpec{{Label: "a"}, {Label: "a"}}); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("Expected ErrInvalidPayload, got %v", err)
+	}
+	createTestUser(t, store, User{Address: "0x1", Schedule: schedule})
+
+	network.Advance(120)
+	entries, err := GetSchedule(store, network, "0x1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || !entries[0].Decryptable || entries[1].Decryptable {
+		t.Fatalf("Bad schedule %+v", entries)
+	}
+}
@@ -0,0 +1,28 @@
+package usecases
+
+import (
+	"time"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+)
+
+type SealedKey struct {
+	Address             string    `json:"address"`
+	PrivateKeyEncrypted string    `json:"private_key_encrypted"`
+	Round               uint64    `json:"round"`
+	UnlockAt            time.Time `json:"unlock_at"`
+}
+
+// Get stored timelock encrypted private key of the user
+func GetSealedKey(store polybase.RecordStore, address string) (SealedKey, error) {
+	user, err := GetUserRecord(store, address)
+	if err != nil {
+		return SealedKey{}, err
+	}
+	return SealedKey{
+		Address:             user.Address,
+		PrivateKeyEncrypted: user.SealedKey,
+		Round:               user.Round,
+		UnlockAt:            user.UnlockAt,
+	}, nil
+}
@@ -0,0 +1,173 @@
+package usecases
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+)
+
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// Refresh token session. Only the hash of the refresh token is stored
+type Session struct {
+	ID        string                 `json:"id"`
+	Address   string                 `json:"address"`
+	Data      map[string]interface{} `json:"data"`
+	ClientID  string                 `json:"client_id,omitempty"` // OAuth client the refresh token is issued to
+	CreatedAt time.Time              `json:"created_at"`
+	ExpiresAt time.Time              `json:"expires_at"`
+	Revoked   bool                   `json:"revoked"`
+	Version   int                    `json:"version"` // store version, revoke fails if the session was changed after it was read
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type SessionUseCase struct {
+	store      polybase.RecordStore
+	issuer     *auth.Issuer
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func NewSessionUseCase(store polybase.RecordStore, issuer *auth.Issuer, accessTTL, refreshTTL time.Duration) *SessionUseCase {
+	return &SessionUseCase{
+		store:      store,
+		issuer:     issuer,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+	}
+}
+
+func (s *SessionUseCase) Issuer() *auth.Issuer {
+	return s.issuer
+}
+
+// Issue access token and start new refresh token session.
+// Roles are read from the user record so refreshed tokens get current roles,
+// disabled users can't start or refresh sessions.
+// Nil key signs the access token with the service key
+func (s *SessionUseCase) Start(address string, data map[string]interface{}, key *ecdsa.PrivateKey) (TokenPair, error) {
+	return s.start(address, data, key, "")
+}
+
+func (s *SessionUseCase) start(address string, data map[string]interface{}, key *ecdsa.PrivateKey, clientID string) (TokenPair, error) {
+	roles, err := UserRoles(s.store, address)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	accessToken, err := CreateAccessToken(s.issuer, s.accessTTL, address, data, roles, key)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refreshToken, err := s.createSession(address, data, clientID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.accessTTL.Seconds()),
+	}, nil
+}
+
+// Issue new access token and rotate refresh token.
+// Refresh tokens issued to OAuth clients are refreshed only at the token endpoint by the client
+func (s *SessionUseCase) Refresh(refreshToken string) (TokenPair, error) {
+	return s.refresh(refreshToken, "")
+}
+
+func (s *SessionUseCase) refresh(refreshToken, clientID string) (TokenPair, error) {
+	session, err := s.getSession(refreshToken)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if session.ClientID != clientID {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+	if err := s.revoke(session); err != nil {
+		return TokenPair{}, err
+	}
+	return s.start(session.Address, session.Data, nil, session.ClientID)
+}
+
+func (s *SessionUseCase) Logout(refreshToken string) error {
+	session, err := s.getSession(refreshToken)
+	if err != nil {
+		return err
+	}
+	return s.revoke(session)
+}
+
+func (s *SessionUseCase) createSession(address string, data map[string]interface{}, clientID string) (string, error) {
+	refreshToken, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	fields, err := toFields(Session{
+		ID:        hashToken(refreshToken),
+		Address:   address,
+		Data:      data,
+		ClientID:  clientID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.refreshTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.store.Create(SessionCollection, hashToken(refreshToken), fields); err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+func (s *SessionUseCase) getSession(refreshToken string) (session Session, err error) {
+	rec, err := s.store.Get(SessionCollection, hashToken(refreshToken))
+	if errors.Is(err, polybase.ErrNotFound) {
+		return session, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return
+	}
+	if err = fromFields(rec, &session); err != nil {
+		return
+	}
+	if session.Revoked || time.Now().After(session.ExpiresAt) {
+		return session, ErrInvalidRefreshToken
+	}
+	return
+}
+
+// Revoke the session as it was read. Concurrent refresh or logout of the same token
+// revokes it first, the second one gets ErrInvalidRefreshToken. Session collected meanwhile is invalid too
+func (s *SessionUseCase) revoke(session Session) error {
+	_, err := s.store.UpdateVersion(SessionCollection, session.ID, session.Version, map[string]interface{}{"revoked": true})
+	if errors.Is(err, polybase.ErrVersionConflict) || errors.Is(err, polybase.ErrNotFound) {
+		return ErrInvalidRefreshToken
+	}
+	return err
+}
+
+func randomToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,98 @@
+package usecases
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
+)
+
+func TestSessionLifecycle(t *testing.T) {
+	store := newTestStore(t)
+	keyring, err := auth.NewKeyring("", auth.AlgES256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := auth.NewIssuer("test", auth.SignWithServiceKey, keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := NewSessionUseCase(store, issuer, time.Minute, time.Hour)
+	verifier := auth.NewVerifier("test", keyring)
+
+	tokens, err := sessions.Start("0xabc", map[string]interface{}{"nick": "alice"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.ExpiresIn != 60 {
+		t.Fatalf("Expected expires_in 60, got %v", tokens.ExpiresIn)
+	}
+
+	refreshed, err := sessions.Refresh(tokens.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := verifier.Verify(refreshed.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "0xabc" || claims.Data["nick"] != "alice" {
+		t.Fatalf("Unexpected claims %+v", claims)
+	}
+
+	// Refresh token is rotated
+	if _, err := sessions.Refresh(tokens.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("Expected ErrInvalidRefreshToken, got %v", err)
+	}
+
+	if err := sessions.Logout(refreshed.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sessions.Refresh(refreshed.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("Expected ErrInvalidRefreshToken, got %v", err)
+	}
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	store := newTestStore(t)
+	keyring, _ := auth.NewKeyring("", auth.AlgES256, 1)
+	issuer, _ := auth.NewIssuer("test", auth.SignWithServiceKey, keyring)
+	sessions := NewSessionUseCase(store, issuer, time.Minute, time.Hour)
+	tokens, err := sessions.Start("0xabc", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both refreshes read the session before either revokes it
+	first, _ := sessions.getSession(tokens.RefreshToken)
+	second, _ := sessions.getSession(tokens.RefreshToken)
+	if err := sessions.revoke(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := sessions.revoke(second); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("Expected ErrInvalidRefreshToken, got %v", err)
+	}
+
+	tokens, err = sessions.Start("0xabc", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	var refreshed int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := sessions.Refresh(tokens.RefreshToken); err == nil {
+				atomic.AddInt32(&refreshed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if refreshed != 1 {
+		t.Fatalf("Expected one refresh, got %d", refreshed)
+	}
+}
@@ -0,0 +1,174 @@
+package usecases
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+	"github.com/torvald2/hack-fs-2023-promise-card/shamir"
+	"github.com/torvald2/hack-fs-2023-promise-card/timelock"
+)
+
+var (
+	ErrInvalidShares   = errors.New("invalid key shares")
+	ErrNotEnoughShares = errors.New("not enough key shares")
+)
+
+// Split of the account key into threshold of M Shamir shares.
+// Some shares are timelocked, others are encrypted to the guardians
+type ShamirSpec struct {
+	Threshold      int             `json:"threshold"`
+	TimelockShares []time.Duration `json:"timelock_shares"` // unlock delay of every timelocked share
+	Guardians      []string        `json:"guardians"`       // hex encoded secp256k1 public keys
+}
+
+// Key share encrypted with ECIES to the guardian public key
+type GuardianShare struct {
+	Guardian   string `json:"guardian"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+type KeyShares struct {
+	Threshold int             `json:"threshold"`
+	Timelock  []ScheduleEntry `json:"timelock"`
+	Guardians []GuardianShare `json:"guardians"`
+}
+
+func (s ShamirSpec) validate() error {
+	parts := len(s.TimelockShares) + len(s.Guardians)
+	if s.Threshold < 2 || s.Threshold > parts || parts > 255 {
+		return fmt.Errorf("%w: bad threshold %d of %d shares", ErrInvalidShares, s.Threshold, parts)
+	}
+	for _, guardian := range s.Guardians {
+		if _, err := parseGuardianKey(guardian); err != nil {
+			return fmt.Errorf("%w: bad guardian key %s: %v", ErrInvalidShares, guardian, err)
+		}
+	}
+	return nil
+}
+
+func parseGuardianKey(guardian string) (*ecdsa.PublicKey, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(guardian, "0x"))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 33 {
+		return crypto.DecompressPubkey(data)
+	}
+	return crypto.UnmarshalPubkey(data)
+}
+
+// Split key, seal timelock shares to their rounds and encrypt the rest to the guardians
+func splitKey(network timelock.Network, key []byte, spec ShamirSpec) ([]ScheduledPayload, []GuardianShare, error) {
+	shares, err := shamir.Split(key, len(spec.TimelockShares)+len(spec.Guardians), spec.Threshold)
+	if err != nil {
+		return nil, nil, err
+	}
+	specs := make([]PayloadSpec, 0, len(spec.TimelockShares))
+	for i, after := range spec.TimelockShares {
+		specs = append(specs, PayloadSpec{
+			Label: fmt.Sprintf("key-share-%d", i+1),
+			Data:  shares[i],
+			After: after,
+		})
+	}
+	sealed, err := SealSchedule(network, specs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range sealed {
+		sealed[i].Share = true
+	}
+	guardianShares := make([]GuardianShare, 0, len(spec.Guardians))
+	for i, guardian := range spec.Guardians {
+		pub, err := parseGuardianKey(guardian)
+		if err != nil {
+			return nil, nil, err
+		}
+		ciphertext, err := ecies.Encrypt(rand.Reader, ecies.ImportECDSAPublic(pub), shares[len(spec.TimelockShares)+i], nil, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		guardianShares = append(guardianShares, GuardianShare{
+			Guardian:   guardian,
+			Ciphertext: hex.EncodeToString(ciphertext),
+		})
+	}
+	return sealed, guardianShares, nil
+}
+
+// Restore key from the supplied shares and the timelocked shares that are already unlocked.
+// Returns LockedError of the nearest share when there are not enough shares yet
+func combineKey(network timelock.Network, user User, supplied []string) ([]byte, error) {
+	parts := make([][]byte, 0, user.ShareThreshold)
+	for _, s := range supplied {
+		share, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidShares, err)
+		}
+		parts = append(parts, share)
+	}
+	var locked *timelock.LockedError
+	current := network.Current(time.Now())
+	for _, payload := range user.Schedule {
+		if !payload.Share || len(parts) >= user.ShareThreshold {
+			continue
+		}
+		if current < payload.Round {
+			if locked == nil || payload.Round < locked.Round {
+				locked = &timelock.LockedError{Round: payload.Round, UnlockAt: payload.UnlockAt}
+			}
+			continue
+		}
+		ciphertext, err := hex.DecodeString(payload.Ciphertext)
+		if err != nil {
+			return nil, err
+		}
+		share, err := timelock.Open(network, ciphertext)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, share)
+	}
+	if len(parts) < user.ShareThreshold {
+		if locked != nil {
+			return nil, locked
+		}
+		return nil, fmt.Errorf("%w: %d of %d", ErrNotEnoughShares, len(parts), user.ShareThreshold)
+	}
+	key, err := shamir.Combine(parts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidShares, err)
+	}
+	return key, nil
+}
+
+// Get timelocked and guardian shares of the card key
+func GetKeyShares(store polybase.RecordStore, network timelock.Network, address string) (KeyShares, error) {
+	schedule, err := GetSchedule(store, network, address)
+	if err != nil {
+		return KeyShares{}, err
+	}
+	user, err := GetUserRecord(store, address)
+	if err != nil {
+		return KeyShares{}, err
+	}
+	shares := KeyShares{
+		Threshold: user.ShareThreshold,
+		Timelock:  make([]ScheduleEntry, 0),
+		Guardians: user.GuardianShares,
+	}
+	for _, entry := range schedule {
+		if entry.Share {
+			shares.Timelock = append(shares.Timelock, entry)
+		}
+	}
+	return shares, nil
+}
@@ -0,0 +1,68 @@
+package usecases
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"github.com/torvald2/hack-fs-2023-promise-card/timelock"
+)
+
+func TestShamirAccount(t *testing.T) {
+	store := newTestStore(t)
+	network, err := timelock.NewLocalNetwork(nil, time.Now().Add(-time.Hour), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guardian, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	us := NewCreateUserUseCase(store, network, "", nil)
+	job := ProvisionJob{ID: "1", Nick: "alice", Shamir: &ShamirSpec{
+		Threshold:      2,
+		TimelockShares: []time.Duration{time.Minute, time.Hour},
+		Guardians:      []string{hex.EncodeToString(crypto.FromECDSAPub(&guardian.PublicKey))},
+	}}
+	if err := job.Shamir.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := us.createAccount(&job); err != nil {
+		t.Fatal(err)
+	}
+	if err := us.createRecord(&job); err != nil {
+		t.Fatal(err)
+	}
+	user, err := GetUserRecord(store, job.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var locked *timelock.LockedError
+	if _, err := combineKey(network, user, nil); !errors.As(err, &locked) {
+		t.Fatalf("Expected LockedError, got %v", err)
+	}
+
+	// Guardian share and the first timelocked share
+	network.Advance(120)
+	ciphertext, _ := hex.DecodeString(user.GuardianShares[0].Ciphertext)
+	share, err := ecies.ImportECDSA(guardian).Decrypt(ciphertext, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := combineKey(network, user, []string{hex.EncodeToString(share)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := crypto.ToECDSA(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crypto.PubkeyToAddress(privateKey.PublicKey).Hex() != job.Address {
+		t.Error("Restored key doesn't match the address")
+	}
+}
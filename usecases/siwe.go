@@ -0,0 +1,68 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
+)
+
+var ErrInvalidNonce = errors.New("invalid or expired nonce")
+
+// Sign-In with Ethereum login of users with unlocked keys
+type SIWELoginUseCase struct {
+	users   GetUserUseCase
+	nonces  *auth.NonceStore
+	domain  string
+	chainID int64
+}
+
+func NewSIWELoginUseCase(users GetUserUseCase, nonces *auth.NonceStore, domain string, chainID int64) SIWELoginUseCase {
+	return SIWELoginUseCase{
+		users:   users,
+		nonces:  nonces,
+		domain:  domain,
+		chainID: chainID,
+	}
+}
+
+// Check EIP-4361 message signed by the card key and start session.
+// The signature is checked over the message as submitted, lines are separated by LF only.
+// Empty domain disables domain check
+func (c *SIWELoginUseCase) Execute(message, signature string) (tokens TokenPair, err error) {
+	msg, err := auth.ParseSIWEMessage(message)
+	if err != nil {
+		return
+	}
+	if c.domain != "" && msg.Domain != c.domain {
+		err = fmt.Errorf("%w: unexpected domain %s", auth.ErrBadSIWEMessage, msg.Domain)
+		return
+	}
+	if msg.ChainID != c.chainID {
+		err = fmt.Errorf("%w: unexpected chain id %d", auth.ErrBadSIWEMessage, msg.ChainID)
+		return
+	}
+	if err = msg.Valid(time.Now()); err != nil {
+		return
+	}
+	if err = auth.VerifySIWESignature(message, msg, signature); err != nil {
+		return
+	}
+	if !c.nonces.Consume(msg.Nonce, msg.Address.Hex()) {
+		err = ErrInvalidNonce
+		return
+	}
+	user, err := GetUserRecord(c.users.store, msg.Address.Hex())
+	if err != nil {
+		return
+	}
+	if err = c.users.checkUnlocked(user); err != nil {
+		return
+	}
+	userData, err := c.users.userData(user)
+	if err != nil {
+		return
+	}
+	return c.users.sessions.Start(user.Address, userData, nil)
+}
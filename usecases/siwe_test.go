@@ -0,0 +1,61 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/torvald2/hack-fs-2023-promise-card/auth"
+)
+
+func TestSIWELoginRejectsMessages(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	nonces := auth.NewNonceStore(time.Minute, 100)
+	nonce, err := nonces.Issue(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	us := NewSIWELoginUseCase(GetUserUseCase{}, nonces, "promisecards.eth", 1)
+	message := func(chainID int, newline string) string {
+		return strings.ReplaceAll(fmt.Sprintf(`promisecards.eth wants you to sign in with your Ethereum account:
+%s
+
+URI: https://promisecards.eth/login
+Version: 1
+Chain ID: %d
+Nonce: %s
+Issued At: %s`, address, chainID, nonce, time.Now().UTC().Format(time.RFC3339)), "\n", newline)
+	}
+	sign := func(message string) string {
+		sig, err := crypto.Sign(accounts.TextHash([]byte(message)), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hexutil.Encode(sig)
+	}
+
+	for name, m := range map[string]string{
+		"other chain": message(5, "\n"),
+		"crlf":        message(1, "\r\n"),
+	} {
+		if _, err := us.Execute(m, sign(m)); !errors.Is(err, auth.ErrBadSIWEMessage) {
+			t.Errorf("%s: expected ErrBadSIWEMessage, got %v", name, err)
+		}
+	}
+	// Signature of the normalized message doesn't match the submitted bytes
+	if _, err := us.Execute(message(1, "\r\n"), sign(message(1, "\n"))); err == nil {
+		t.Error("Expected error for the signature of other bytes")
+	}
+	if !nonces.Consume(nonce, address) {
+		t.Error("Rejected messages must not consume the nonce")
+	}
+}
@@ -0,0 +1,109 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/ens"
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+)
+
+// Limits of one text records update, every record costs the root owner gas
+const (
+	MaxTextRecords     = 10
+	MaxTextValueLength = 256
+)
+
+// Text records job step
+const StepTextRecords = "text_records"
+
+var ErrTextRecordsLimit = errors.New("text records limit exceeded")
+
+// Keys returned when none are requested
+var DefaultTextKeys = append(append([]string{}, ens.GlobalTextKeys...), "com.twitter", "com.github", "com.discord", "org.telegram")
+
+// Text records of the user subdomain
+type TextRecordsUseCase struct {
+	store      polybase.RecordStore
+	ensService *ens.ENSAdaptor
+}
+
+func NewTextRecordsUseCase(store polybase.RecordStore, ensService *ens.ENSAdaptor) TextRecordsUseCase {
+	return TextRecordsUseCase{
+		store:      store,
+		ensService: ensService,
+	}
+}
+
+func (c *TextRecordsUseCase) Get(address string, keys []string) (map[string]string, error) {
+	user, err := GetUserRecord(c.store, address)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		keys = DefaultTextKeys
+	}
+	if err := checkTextKeys(keys); err != nil {
+		return nil, err
+	}
+	return c.ensService.Texts(user.Nick, keys)
+}
+
+// Set records of the job, in one transaction when the resolver supports multicall. Empty value removes the record.
+// Transactions of the interrupted job are waited for instead of being sent again
+func (c *TextRecordsUseCase) Execute(job *ProvisionJob, save func(*ProvisionJob) error) error {
+	job.Status = JobRunning
+	if err := save(job); err != nil {
+		return err
+	}
+	state := job.step(StepTextRecords)
+	var err error
+	job.RecordsTx, err = c.ensService.SetTexts(job.Nick, job.Records, jobJournal(job, &job.RecordsTx, save))
+	if err != nil {
+		state.Status = StepStatusFailed
+		state.Error = err.Error()
+		job.Status = JobFailed
+		job.Error = err.Error()
+		if saveErr := save(job); saveErr != nil {
+			return saveErr
+		}
+		return err
+	}
+	state.Status = StepStatusDone
+	job.Status = JobDone
+	return save(job)
+}
+
+// User of the records update. Keys, number of records and value length are checked
+func (c *TextRecordsUseCase) check(address string, records map[string]string) (user User, err error) {
+	if !c.ensService.KeepCustody {
+		return user, ens.ErrNotCustodian
+	}
+	if user, err = GetUserRecord(c.store, address); err != nil {
+		return
+	}
+	if user.Disabled {
+		return user, ErrUserDisabled
+	}
+	if len(records) == 0 || len(records) > MaxTextRecords {
+		return user, fmt.Errorf("%w: 1 to %d records", ErrTextRecordsLimit, MaxTextRecords)
+	}
+	keys := make([]string, 0, len(records))
+	for key, value := range records {
+		if len(value) > MaxTextValueLength {
+			return user, fmt.Errorf("%w: %s value is longer than %d bytes", ErrTextRecordsLimit, key, MaxTextValueLength)
+		}
+		keys = append(keys, key)
+	}
+	err = checkTextKeys(keys)
+	return
+}
+
+func checkTextKeys(keys []string) error {
+	for _, key := range keys {
+		if !ens.ValidTextKey(key) {
+			return fmt.Errorf("%w: %s", ens.ErrBadTextKey, key)
+		}
+	}
+	return nil
+}
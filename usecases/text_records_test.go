@@ -0,0 +1,65 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/ens"
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+)
+
+func TestUpdateTextRecords(t *testing.T) {
+	store := newTestStore(t, User{Address: "0xabc", Nick: "alice"}, User{Address: "0xdef", Nick: "bob", Disabled: true})
+	ensService := ens.NewENSAdaptor(ens.Config{MainDomain: "promisecard.eth"})
+	defer ensService.Close()
+	provisioner := NewProvisioner(store, NewCreateUserUseCase(store, nil, "", ensService))
+	records := NewTextRecordsUseCase(store, ensService)
+	url := map[string]string{"url": "https://example.com"}
+
+	if _, err := provisioner.EnqueueTextRecords("0xabc", url); !errors.Is(err, ens.ErrNotCustodian) {
+		t.Fatalf("Expected ErrNotCustodian, got %v", err)
+	}
+	ensService.KeepCustody = true
+	if _, err := provisioner.EnqueueTextRecords("0x123", url); !errors.Is(err, polybase.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := provisioner.EnqueueTextRecords("0xdef", url); !errors.Is(err, ErrUserDisabled) {
+		t.Fatalf("Expected ErrUserDisabled, got %v", err)
+	}
+	if _, err := provisioner.EnqueueTextRecords("0xabc", map[string]string{"url": "https://example.com", "Twitter": "alice"}); !errors.Is(err, ens.ErrBadTextKey) {
+		t.Fatalf("Expected ErrBadTextKey, got %v", err)
+	}
+	if _, err := provisioner.EnqueueTextRecords("0xabc", map[string]string{"url": strings.Repeat("a", MaxTextValueLength+1)}); !errors.Is(err, ErrTextRecordsLimit) {
+		t.Fatalf("Expected ErrTextRecordsLimit, got %v", err)
+	}
+	many := make(map[string]string)
+	for i := 0; i <= MaxTextRecords; i++ {
+		many[fmt.Sprintf("com.service%d", i)] = "alice"
+	}
+	if _, err := provisioner.EnqueueTextRecords("0xabc", many); !errors.Is(err, ErrTextRecordsLimit) {
+		t.Fatalf("Expected ErrTextRecordsLimit, got %v", err)
+	}
+	if _, err := records.Get("0xabc", []string{"com.twitter", "bad key"}); !errors.Is(err, ens.ErrBadTextKey) {
+		t.Fatalf("Expected ErrBadTextKey, got %v", err)
+	}
+
+	job, err := provisioner.EnqueueTextRecords("0xabc", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := GetJob(store, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Kind != JobKindTextRecords || saved.Status != JobQueued || saved.Nick != "alice" || saved.Records["url"] != url["url"] {
+		t.Fatalf("Unexpected job %+v", saved)
+	}
+	// Write of the closed service fails the job
+	ensService.Close()
+	provisioner.run(job.ID)
+	if saved, _ = GetJob(store, job.ID); saved.Status != JobFailed || saved.Steps[0].Status != StepStatusFailed {
+		t.Fatalf("Unexpected job %+v", saved)
+	}
+}
@@ -0,0 +1,26 @@
+package usecases
+
+import (
+	"encoding/hex"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/timelock"
+)
+
+type UnlockStatusUseCase struct {
+	network timelock.Network
+}
+
+func NewUnlockStatusUseCase(network timelock.Network) UnlockStatusUseCase {
+	return UnlockStatusUseCase{
+		network: network,
+	}
+}
+
+// Get unlock status of the hex encoded timelock ciphertext
+func (c *UnlockStatusUseCase) Execute(key string) (status timelock.Status, err error) {
+	keyBytes, err := hex.DecodeString(key)
+	if err != nil {
+		return
+	}
+	return timelock.Inspect(c.network, keyBytes)
+}
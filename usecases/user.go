@@ -0,0 +1,34 @@
+package usecases
+
+import (
+	"time"
+
+	"github.com/torvald2/hack-fs-2023-promise-card/polybase"
+)
+
+// User record kept in the record store by address
+type User struct {
+	Address   string    `json:"id"`
+	Nick      string    `json:"nick"`
+	SealedKey string    `json:"sealed_key"` // hex encoded timelock ciphertext of the private key
+	Round     uint64    `json:"round"`
+	UnlockAt  time.Time `json:"unlock_at"`
+	// Additional timelocked payloads
+	Schedule []ScheduledPayload `json:"schedule"`
+	// Shamir split of the private key, zero threshold means the whole key is sealed
+	ShareThreshold int             `json:"share_threshold"`
+	GuardianShares []GuardianShare `json:"guardian_shares"`
+	Roles          []string        `json:"roles"`
+	CID            string          `json:"cid"` // pinned avatar
+	Disabled       bool            `json:"disabled"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+func GetUserRecord(store polybase.RecordStore, address string) (user User, err error) {
+	rec, err := store.Get(UserCollection, address)
+	if err != nil {
+		return
+	}
+	err = fromFields(rec, &user)
+	return
+}